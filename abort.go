@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// errTokenInvalidated is returned for every request once the access token
+// has been reported invalid.
+var errTokenInvalidated = errors.New("access token invalidated")
+
+// runAbort is shared by all client copies and stops the whole run once one
+// worker sees the access token die, instead of every worker running into
+// the same error on its own. Cancelling its context also ends requests
+// that are already in flight.
+type runAbort struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func newRunAbort() *runAbort {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &runAbort{ctx: ctx, cancel: cancel}
+}
+
+// trip aborts the run. Only the first call logs.
+func (a *runAbort) trip(err error) {
+	a.once.Do(func() {
+		log.Printf("ERROR: token invalidated, aborting run: %v", err)
+		a.cancel()
+	})
+}
+
+// aborted reports whether the run has been aborted.
+func (a *runAbort) aborted() bool {
+	return a.ctx.Err() != nil
+}
+
+// isTokenInvalidError reports whether err means the access token itself is
+// no longer valid (code 190, or 102 for an invalid session), as opposed to
+// lacking a permission.
+func isTokenInvalidError(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == 190 || apiErr.Code == 102
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var accountIDPattern = regexp.MustCompile(`^act_\d+$`)
+
+// readAccountsFile reads one ad account ID per line. Blank lines and
+// anything after a '#' are ignored; every malformed line is reported.
+func readAccountsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening accounts file: %w", err)
+	}
+	defer file.Close()
+	
+	var ids, malformed []string
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !accountIDPattern.MatchString(line) {
+			malformed = append(malformed, fmt.Sprintf("line %d: %q", lineNumber, line))
+			continue
+		}
+		ids = append(ids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading accounts file: %w", err)
+	}
+	if len(malformed) > 0 {
+		return nil, fmt.Errorf("%d malformed account IDs (expected act_<digits>):\n  %s", len(malformed), strings.Join(malformed, "\n  "))
+	}
+	return ids, nil
+}
+
+// parseAccountIDs validates the comma-separated -accounts value.
+func parseAccountIDs(value string) ([]string, error) {
+	ids := splitList(value)
+	for _, id := range ids {
+		if !accountIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("malformed account ID %q (expected act_<digits>)", id)
+		}
+	}
+	return ids, nil
+}
+
+// discoveryBackoff is the pause before the first retry of account
+// discovery; it doubles with every further attempt.
+var discoveryBackoff = 10 * time.Second
+
+// discoverAccounts runs account discovery, retrying up to retries times
+// with growing pauses when it fails for a transient reason, so a short
+// outage at start-up doesn't abort a whole batch. -no-retry and the
+// -max-run-time deadline apply as to any other request.
+func (c *APIClient) discoverAccounts(retries int) ([]AdAccount, error) {
+	accounts, err := c.fetchAdAccounts()
+	for attempt := 1; err != nil && attempt <= retries && isTransientError(err); attempt++ {
+		if c.config.NoRetry {
+			return nil, fmt.Errorf("%w, not retrying because of -no-retry", err)
+		}
+		wait := discoveryBackoff << uint(attempt-1)
+		if deadlineErr := c.checkDeadline(wait); deadlineErr != nil {
+			return nil, fmt.Errorf("%w, not retrying: %w", err, deadlineErr)
+		}
+		c.logf("Account discovery failed (%v), retrying in %v (%d/%d)", err, wait, attempt, retries)
+		time.Sleep(wait)
+		accounts, err = c.fetchAdAccounts()
+	}
+	return accounts, err
+}
+
+// fetchAccountsByID looks up the given accounts directly instead of
+// discovering them. Accounts that can't be read are logged and skipped.
+func (c *APIClient) fetchAccountsByID(ids []string) []AdAccount {
+	var accounts []AdAccount
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		
+		data, err := c.makeRequest(id + "?fields=id,name,account_id,currency")
+		if err != nil {
+			c.logf("Error looking up account %s: %v", id, err)
+			continue
+		}
+		var account AdAccount
+		if err := json.Unmarshal(data, &account); err != nil {
+			c.logf("Error parsing account %s: %v", id, err)
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails the first failures requests with a network error
+// and then answers with a list of two ad accounts.
+type flakyTransport struct {
+	failures int
+	requests int
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	if t.requests <= t.failures {
+		return nil, errors.New("connection reset by peer")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"data":[{"id":"act_1","account_id":"1","name":"One"},{"id":"act_2","account_id":"2","name":"Two"}]}`)),
+		Request:    req,
+	}, nil
+}
+
+func withDiscoveryBackoff(t *testing.T, d time.Duration) {
+	t.Helper()
+	previous := discoveryBackoff
+	discoveryBackoff = d
+	t.Cleanup(func() { discoveryBackoff = previous })
+}
+
+func TestDiscoverAccountsRetriesTransientFailure(t *testing.T) {
+	withDiscoveryBackoff(t, time.Millisecond)
+	transport := &flakyTransport{failures: 2}
+	accounts, err := newTestClient(transport).discoverAccounts(3)
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].ID != "act_1" || accounts[1].ID != "act_2" {
+		t.Errorf("accounts = %+v, want act_1 and act_2", accounts)
+	}
+	if transport.requests != 3 {
+		t.Errorf("made %d requests, want 3", transport.requests)
+	}
+}
+
+func TestDiscoverAccountsGivesUp(t *testing.T) {
+	withDiscoveryBackoff(t, time.Millisecond)
+	transport := &flakyTransport{failures: 10}
+	if _, err := newTestClient(transport).discoverAccounts(2); err == nil {
+		t.Fatal("discovery succeeded despite failing every time")
+	}
+	if transport.requests != 3 {
+		t.Errorf("made %d requests, want 3", transport.requests)
+	}
+}
+
+func TestDiscoverAccountsNoRetry(t *testing.T) {
+	withDiscoveryBackoff(t, time.Hour)
+	transport := &flakyTransport{failures: 1}
+	client := newTestClient(transport)
+	client.config.NoRetry = true
+	if _, err := client.discoverAccounts(3); err == nil || !strings.Contains(err.Error(), "-no-retry") {
+		t.Fatalf("err = %v, want a -no-retry failure", err)
+	}
+	if transport.requests != 1 {
+		t.Errorf("made %d requests, want 1", transport.requests)
+	}
+}
+
+func TestDiscoverAccountsRespectsDeadline(t *testing.T) {
+	withDiscoveryBackoff(t, time.Hour)
+	transport := &flakyTransport{failures: 1}
+	client := newTestClient(transport)
+	client.deadline = time.Now().Add(time.Minute)
+	started := time.Now()
+	_, err := client.discoverAccounts(3)
+	if !errors.Is(err, errRunDeadline) {
+		t.Fatalf("err = %v, want errRunDeadline", err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Errorf("waited %v despite the deadline", time.Since(started))
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+)
+
+// bqColumnPattern matches names BigQuery accepts as column names.
+var bqColumnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// bqRawColumn holds the JSON of every field that isn't promoted to a
+// typed column.
+const bqRawColumn = "raw"
+
+type bqField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+}
+
+// bqType returns the BigQuery type of a decoded JSON scalar, or "" for
+// objects, arrays and nulls.
+func bqType(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return "STRING"
+	case bool:
+		return "BOOLEAN"
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return "INTEGER"
+		}
+		return "FLOAT"
+	}
+	return ""
+}
+
+// inferBQSchema picks the top-level fields that hold the same scalar type
+// in every record that has them. INTEGER and FLOAT widen to FLOAT; any
+// other mix, or a nested value, keeps the field in the raw column.
+func inferBQSchema(records []map[string]interface{}) []bqField {
+	types := make(map[string]string)
+	rejected := make(map[string]bool)
+	for _, record := range records {
+		for key, value := range record {
+			if value == nil || rejected[key] {
+				continue
+			}
+			t := bqType(value)
+			switch {
+			case t == "" || key == bqRawColumn || !bqColumnPattern.MatchString(key):
+				rejected[key] = true
+			case types[key] == "" || types[key] == t:
+				types[key] = t
+			case (types[key] == "INTEGER" && t == "FLOAT") || (types[key] == "FLOAT" && t == "INTEGER"):
+				types[key] = "FLOAT"
+			default:
+				rejected[key] = true
+			}
+		}
+	}
+	
+	var fields []bqField
+	for key, t := range types {
+		if !rejected[key] {
+			fields = append(fields, bqField{Name: key, Type: t, Mode: "NULLABLE"})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return append(fields, bqField{Name: bqRawColumn, Type: "STRING", Mode: "NULLABLE"})
+}
+
+// writeBigQueryDump writes <base>.bq.ndjson with one row per record and
+// <base>.bq_schema.json describing it, ready for
+// bq load --source_format=NEWLINE_DELIMITED_JSON.
+func (c *APIClient) writeBigQueryDump(base string, formatted []byte) error {
+	records, err := dumpRecords(formatted)
+	if err != nil {
+		return err
+	}
+	schema := inferBQSchema(records)
+	promoted := make(map[string]bool, len(schema))
+	for _, field := range schema {
+		if field.Name != bqRawColumn {
+			promoted[field.Name] = true
+		}
+	}
+	
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		row := make(map[string]interface{})
+		rest := make(map[string]interface{})
+		for key, value := range record {
+			if promoted[key] {
+				row[key] = value
+			} else {
+				rest[key] = value
+			}
+		}
+		if len(rest) > 0 {
+			raw, _ := json.Marshal(rest)
+			row[bqRawColumn] = string(raw)
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	
+	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
+	if err := c.writeOutput(base+".bq_schema.json", schemaJSON); err != nil {
+		return err
+	}
+	filename := base + ".bq.ndjson"
+	if err := c.writeOutput(filename, buf.Bytes()); err != nil {
+		return err
+	}
+	c.logf("Saved to: %s (BigQuery schema in %s)", filename, base+".bq_schema.json")
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// budgetFields are the campaign and ad set fields the Graph API returns in
+// the minor unit of the account currency.
+var budgetFields = []string{"daily_budget", "lifetime_budget", "budget_remaining", "spend_cap"}
+
+// zeroOffsetCurrencies are the currencies the Graph API counts in whole
+// units, so their budgets already are major-unit values. All other
+// currencies use an offset of 100.
+var zeroOffsetCurrencies = map[string]bool{
+	"CLP": true, "COP": true, "CRC": true, "HUF": true, "ISK": true, "IDR": true,
+	"JPY": true, "KRW": true, "PYG": true, "TWD": true, "VND": true,
+}
+
+// minorUnitDigits returns the number of decimal digits between the amounts
+// the Graph API reports for a currency and its major unit.
+func minorUnitDigits(currency string) int {
+	if zeroOffsetCurrencies[strings.ToUpper(currency)] {
+		return 0
+	}
+	return 2
+}
+
+// toMajorUnits converts a minor-unit amount such as "5000" to a decimal
+// major-unit amount such as "50.00".
+func toMajorUnits(amount string, digits int) (string, error) {
+	minor, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	if digits == 0 {
+		return strconv.FormatInt(minor, 10), nil
+	}
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	scale := int64(1)
+	for i := 0; i < digits; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/scale, digits, minor%scale), nil
+}
+
+// budgetsAsMajor rewrites the budget fields of campaigns and ad sets as
+// major-unit decimal numbers for -budget-as-major. Records are left as
+// they are when the account currency is unknown.
+func (c *APIClient) budgetsAsMajor(records []json.RawMessage) []json.RawMessage {
+	if !c.config.BudgetAsMajor {
+		return records
+	}
+	currency := c.currency
+	if currency == "" {
+		var account AdAccount
+		data, err := c.makeRequest(c.accountID + "?fields=currency")
+		if err == nil {
+			err = json.Unmarshal(data, &account)
+		}
+		if err != nil || account.Currency == "" {
+			c.logf("Currency of %s unknown, leaving budgets in minor units: %v", c.accountID, err)
+			return records
+		}
+		currency = account.Currency
+	}
+	digits := minorUnitDigits(currency)
+	
+	for i, raw := range records {
+		var record map[string]interface{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		changed := false
+		for _, field := range budgetFields {
+			amount, ok := record[field].(string)
+			if !ok {
+				continue
+			}
+			major, err := toMajorUnits(amount, digits)
+			if err != nil {
+				continue
+			}
+			record[field] = json.Number(major)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if converted, err := json.Marshal(record); err == nil {
+			records[i] = converted
+		}
+	}
+	return records
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// checksumRecorder collects the SHA-256 of every output file written with
+// -checksums, keyed by path relative to the output directory.
+type checksumRecorder struct {
+	root string
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+func newChecksumRecorder(root string) *checksumRecorder {
+	return &checksumRecorder{root: root, sums: make(map[string]string)}
+}
+
+func (r *checksumRecorder) add(filename, sum string) {
+	key := filename
+	if rel, err := filepath.Rel(r.root, filename); err == nil {
+		key = filepath.ToSlash(rel)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sums[key] = sum
+}
+
+// all returns a copy of the recorded checksums.
+func (r *checksumRecorder) all() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sums := make(map[string]string, len(r.sums))
+	for k, v := range r.sums {
+		sums[k] = v
+	}
+	return sums
+}
+
+// writeOutput writes an output file. With -checksums the data is hashed
+// while it is written and a sha256sum-compatible <filename>.sha256 sidecar
+// is written next to it.
+func (c *APIClient) writeOutput(filename string, data []byte) error {
+	return c.writeOutputStream(filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeOutputStream is writeOutput for content produced by write, for
+// files too large to build in memory.
+// With -encrypt-key the content is collected and sealed first, and written
+// as <filename>.enc.
+func (c *APIClient) writeOutputStream(filename string, write func(io.Writer) error) error {
+	if c.encryptor != nil {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return err
+		}
+		sealed, err := c.encryptor.seal(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", filename, err)
+		}
+		filename = c.writtenName(filename)
+		write = func(w io.Writer) error {
+			_, err := w.Write(sealed)
+			return err
+		}
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, c.config.FileMode)
+	if err != nil {
+		return err
+	}
+	
+	var w io.Writer = file
+	var h hash.Hash
+	if c.checksums != nil {
+		h = sha256.New()
+		w = io.MultiWriter(file, h)
+	}
+	if err := write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.filesWritten, 1)
+	if h == nil {
+		return nil
+	}
+	
+	sum := hex.EncodeToString(h.Sum(nil))
+	sidecar := fmt.Sprintf("%s  %s\n", sum, filepath.Base(filename))
+	if err := os.WriteFile(filename+".sha256", []byte(sidecar), c.config.FileMode); err != nil {
+		return fmt.Errorf("writing checksum: %w", err)
+	}
+	c.checksums.add(filename, sum)
+	return nil
+}
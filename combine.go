@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// combinedCSV collects the records of every account for -combine-accounts.
+// Records are spooled to a temporary NDJSON file per resource as accounts
+// complete, so memory stays bounded; the CSV is written at the end, once
+// the union of columns is known. Each account's records are remembered as
+// a segment of the spool, so the CSV lists accounts in discovery order
+// however the concurrent accounts finished.
+type combinedCSV struct {
+	dir    string
+	mu     sync.Mutex
+	spools map[string]*combinedSpool
+}
+
+type combinedSpool struct {
+	file     *os.File
+	enc      *json.Encoder
+	columns  map[string]bool
+	rows     int
+	segments map[string][]spoolSegment // by account ID
+}
+
+// spoolSegment is a byte range of a spool file written by one add call.
+type spoolSegment struct {
+	offset int64
+	size   int64
+}
+
+func newCombinedCSV(dir string) *combinedCSV {
+	return &combinedCSV{dir: dir, spools: make(map[string]*combinedSpool)}
+}
+
+// add appends the records of one account to the resource's spool, setting
+// account_id on records that don't carry it.
+func (cc *combinedCSV) add(resource, accountID string, records []map[string]interface{}) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	
+	spool, ok := cc.spools[resource]
+	if !ok {
+		file, err := os.CreateTemp(cc.dir, ".combined_"+resource+"_*.ndjson")
+		if err != nil {
+			return fmt.Errorf("creating spool file: %w", err)
+		}
+		spool = &combinedSpool{
+			file:     file,
+			enc:      json.NewEncoder(file),
+			columns:  map[string]bool{"account_id": true},
+			segments: make(map[string][]spoolSegment),
+		}
+		cc.spools[resource] = spool
+	}
+	
+	start, err := spool.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("writing spool file: %w", err)
+	}
+	id := strings.TrimPrefix(accountID, "act_")
+	for _, record := range records {
+		if _, ok := record["account_id"]; !ok {
+			record["account_id"] = id
+		}
+		for key := range record {
+			spool.columns[key] = true
+		}
+		if err := spool.enc.Encode(record); err != nil {
+			return fmt.Errorf("writing spool file: %w", err)
+		}
+		spool.rows++
+	}
+	end, err := spool.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("writing spool file: %w", err)
+	}
+	spool.segments[accountID] = append(spool.segments[accountID], spoolSegment{offset: start, size: end - start})
+	return nil
+}
+
+// combineDump adds a dump to -combine-accounts. Dumps outside an account,
+// such as the business users, are not combined.
+func (c *APIClient) combineDump(name string, formatted []byte) error {
+	if c.combined == nil || c.accountID == "" {
+		return nil
+	}
+	records, err := dumpRecords(formatted)
+	if err != nil {
+		return err
+	}
+	return c.combined.add(name, c.accountID, records)
+}
+
+// writeCombinedCSVs writes <resource>.csv in the output directory for
+// every spooled resource and removes the spool files. account_id comes
+// first, the other columns follow in sorted order. Rows are grouped by
+// account in the order of accountIDs; accounts not listed follow sorted by
+// ID.
+func (c *APIClient) writeCombinedCSVs(accountIDs []string) error {
+	cc := c.combined
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	
+	resources := make([]string, 0, len(cc.spools))
+	for resource := range cc.spools {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	
+	var firstErr error
+	for _, resource := range resources {
+		spool := cc.spools[resource]
+		filename := filepath.Join(cc.dir, resource+".csv")
+		err := c.writeOutputStream(filename, func(w io.Writer) error {
+			return spool.writeCSV(w, accountIDs)
+		})
+		spool.file.Close()
+		os.Remove(spool.file.Name())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("writing %s: %w", filename, err)
+			}
+			continue
+		}
+		c.logf("Saved %d rows from all accounts to: %s", spool.rows, filename)
+	}
+	cc.spools = make(map[string]*combinedSpool)
+	return firstErr
+}
+
+// accountOrder returns the spooled accounts, those in accountIDs first
+// and in that order.
+func (s *combinedSpool) accountOrder(accountIDs []string) []string {
+	var order []string
+	listed := make(map[string]bool)
+	for _, id := range accountIDs {
+		if _, ok := s.segments[id]; ok && !listed[id] {
+			listed[id] = true
+			order = append(order, id)
+		}
+	}
+	var rest []string
+	for id := range s.segments {
+		if !listed[id] {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+func (s *combinedSpool) writeCSV(w io.Writer, accountIDs []string) error {
+	columns := make([]string, 0, len(s.columns))
+	for key := range s.columns {
+		if key != "account_id" {
+			columns = append(columns, key)
+		}
+	}
+	sort.Strings(columns)
+	columns = append([]string{"account_id"}, columns...)
+	
+	out := csv.NewWriter(w)
+	out.Write(columns)
+	for _, id := range s.accountOrder(accountIDs) {
+		for _, segment := range s.segments[id] {
+			dec := json.NewDecoder(bufio.NewReader(io.NewSectionReader(s.file, segment.offset, segment.size)))
+			for {
+				var record map[string]interface{}
+				if err := dec.Decode(&record); err == io.EOF {
+					break
+				} else if err != nil {
+					return fmt.Errorf("reading spool file: %w", err)
+				}
+				row := make([]string, len(columns))
+				for i, column := range columns {
+					if value, ok := record[column]; ok && value != nil {
+						row[i] = jsonScalarString(value)
+					}
+				}
+				out.Write(row)
+			}
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// fieldChange is the old and new value of a changed field. A field that
+// only exists on one side has null on the other.
+type fieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// modifiedObject lists the fields of an object that differ between two
+// snapshots, by dotted path for fields in nested objects.
+type modifiedObject struct {
+	ID      string                 `json:"id"`
+	Changes map[string]fieldChange `json:"changes"`
+}
+
+// comparison is the report -compare prints.
+type comparison struct {
+	Old      string           `json:"old"`
+	New      string           `json:"new"`
+	Added    []string         `json:"added"`
+	Removed  []string         `json:"removed"`
+	Modified []modifiedObject `json:"modified"`
+	// Unkeyed counts records without an id, which can't be matched
+	Unkeyed int `json:"unkeyed,omitempty"`
+}
+
+// recordsByID decodes the records of a dump keyed by id. The _meta object
+// of -tag-records differs between every run and is left out.
+func recordsByID(records []json.RawMessage) (map[string]map[string]interface{}, int, error) {
+	byID := make(map[string]map[string]interface{}, len(records))
+	unkeyed := 0
+	for i, raw := range records {
+		var record map[string]interface{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, 0, fmt.Errorf("parsing record %d: %w", i, err)
+		}
+		id, _ := record["id"].(string)
+		if id == "" {
+			unkeyed++
+			continue
+		}
+		delete(record, "_meta")
+		byID[id] = record
+	}
+	return byID, unkeyed, nil
+}
+
+// fieldDelta records the differences between two values under path.
+// Objects are compared field by field, appending the key to the path;
+// anything else, arrays included, is compared as a whole.
+func fieldDelta(path string, old, new interface{}, changes map[string]fieldChange) {
+	oldObject, oldOK := old.(map[string]interface{})
+	newObject, newOK := new.(map[string]interface{})
+	if !oldOK || !newOK {
+		if !reflect.DeepEqual(old, new) {
+			changes[path] = fieldChange{Old: old, New: new}
+		}
+		return
+	}
+	
+	keys := make(map[string]bool, len(oldObject)+len(newObject))
+	for key := range oldObject {
+		keys[key] = true
+	}
+	for key := range newObject {
+		keys[key] = true
+	}
+	for key := range keys {
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		fieldDelta(child, oldObject[key], newObject[key], changes)
+	}
+}
+
+// compareDumps matches the records of two dumps of a resource by id and
+// reports the added and removed IDs and, for modified objects, only the
+// fields that changed.
+func compareDumps(oldPath, newPath string, material *keyMaterial) (comparison, error) {
+	report := comparison{Old: oldPath, New: newPath, Added: []string{}, Removed: []string{}, Modified: []modifiedObject{}}
+	snapshots := make([]map[string]map[string]interface{}, 2)
+	for i, path := range []string{oldPath, newPath} {
+		records, err := readDumpRecords(path, material)
+		if err != nil {
+			return report, err
+		}
+		byID, unkeyed, err := recordsByID(records)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", path, err)
+		}
+		snapshots[i] = byID
+		report.Unkeyed += unkeyed
+	}
+	oldRecords, newRecords := snapshots[0], snapshots[1]
+	
+	for id, record := range newRecords {
+		previous, ok := oldRecords[id]
+		if !ok {
+			report.Added = append(report.Added, id)
+			continue
+		}
+		changes := make(map[string]fieldChange)
+		fieldDelta("", previous, record, changes)
+		if len(changes) > 0 {
+			report.Modified = append(report.Modified, modifiedObject{ID: id, Changes: changes})
+		}
+	}
+	for id := range oldRecords {
+		if _, ok := newRecords[id]; !ok {
+			report.Removed = append(report.Removed, id)
+		}
+	}
+	sort.Strings(report.Added)
+	sort.Strings(report.Removed)
+	sort.Slice(report.Modified, func(i, j int) bool { return report.Modified[i].ID < report.Modified[j].ID })
+	return report, nil
+}
+
+// runCompare runs -compare with "old,new" dump paths and writes the report
+// to w as JSON. keySpec is -encrypt-key, needed for encrypted dumps.
+func runCompare(spec, keySpec string, w io.Writer) error {
+	paths := splitList(spec)
+	if len(paths) != 2 {
+		return fmt.Errorf("expected two dump files as old,new, got %q", spec)
+	}
+	var material *keyMaterial
+	if keySpec != "" {
+		loaded, err := loadKeyMaterial(keySpec)
+		if err != nil {
+			return fmt.Errorf("invalid -encrypt-key: %w", err)
+		}
+		material = &loaded
+	}
+	report, err := compareDumps(paths[0], paths[1], material)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding comparison: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
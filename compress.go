@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// compressedFiles lists the dumps written gzip-compressed because of
+// -compress-threshold, relative to the output directory, for the manifest.
+type compressedFiles struct {
+	root  string
+	mu    sync.Mutex
+	files []string
+}
+
+func newCompressedFiles(root string) *compressedFiles {
+	return &compressedFiles{root: root}
+}
+
+func (f *compressedFiles) add(filename string) {
+	if rel, err := filepath.Rel(f.root, filename); err == nil {
+		filename = filepath.ToSlash(rel)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files = append(f.files, filename)
+}
+
+// all returns the compressed files in sorted order.
+func (f *compressedFiles) all() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	files := append([]string(nil), f.files...)
+	sort.Strings(files)
+	return files
+}
+
+// writeDumpOutput writes a dump file, gzip-compressed to <filename>.gz when
+// it is larger than -compress-threshold, and returns the name written.
+func (c *APIClient) writeDumpOutput(filename string, data []byte) (string, error) {
+	if c.config.CompressThreshold <= 0 || int64(len(data)) <= c.config.CompressThreshold {
+		return c.writtenName(filename), c.writeOutput(filename, data)
+	}
+	
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	filename += ".gz"
+	if err := c.writeOutput(filename, buf.Bytes()); err != nil {
+		return "", err
+	}
+	filename = c.writtenName(filename)
+	if c.compressed != nil {
+		c.compressed.add(filename)
+	}
+	return filename, nil
+}
+
+// readDumpFile reads a dump, decrypting it when it was written with
+// -encrypt-key and decompressing it when it was written as .gz. material
+// is nil when no -encrypt-key was given.
+func readDumpFile(path string, material *keyMaterial) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := path
+	if strings.HasSuffix(name, encryptedSuffix) {
+		if material == nil {
+			return nil, fmt.Errorf("%s is encrypted and can only be read with -encrypt-key", path)
+		}
+		if data, err = decryptFile(data, *material); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		name = strings.TrimSuffix(name, encryptedSuffix)
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return data, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
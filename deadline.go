@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errRunDeadline is returned instead of making a request, or sleeping
+// before one, that would end past the -max-run-time deadline.
+var errRunDeadline = errors.New("run deadline reached (-max-run-time)")
+
+// checkDeadline returns errRunDeadline when waiting for wait before the
+// next request would pass the run deadline.
+func (c *APIClient) checkDeadline(wait time.Duration) error {
+	if c.deadline.IsZero() {
+		return nil
+	}
+	remaining := time.Until(c.deadline)
+	if remaining <= 0 {
+		return errRunDeadline
+	}
+	if wait > remaining {
+		return fmt.Errorf("%w: waiting %v would exceed the remaining %v", errRunDeadline,
+			wait.Round(time.Second), remaining.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Files written with -encrypt-key get encryptedSuffix and start with a
+// header of encryptedMagic, the key mode, the passphrase salt and the GCM
+// nonce. The header is authenticated along with the ciphertext.
+const (
+	encryptedSuffix = ".enc"
+	encryptedMagic  = "FBADENC1"
+	
+	keyModeRaw        = 0 // 32-byte key from a key file
+	keyModePassphrase = 1 // key derived from a passphrase with PBKDF2
+	
+	encryptSaltSize = 16
+	encryptKeySize  = 32 // AES-256
+	
+	// pbkdf2Iterations follows the OWASP recommendation for
+	// PBKDF2-HMAC-SHA256. The key is derived once per run, not per file.
+	pbkdf2Iterations = 600000
+)
+
+var errNotEncrypted = errors.New("not a file written with -encrypt-key")
+
+// keyMaterial is what -encrypt-key resolves to: a raw key, or a
+// passphrase to derive one from.
+type keyMaterial struct {
+	raw        []byte
+	passphrase []byte
+	// derived caches passphrase keys by salt, so reading a dump more than
+	// once doesn't repeat PBKDF2
+	derived *sync.Map
+}
+
+// Prefixes of the -encrypt-key forms. There is no default form, so a
+// mistyped key file path can't silently turn into the passphrase.
+const (
+	keySpecFile     = "file:"     // key file with 32 raw bytes or 64 hex digits
+	keySpecPassFile = "passfile:" // file holding a passphrase
+	keySpecPass     = "pass:"     // the passphrase itself
+)
+
+// loadKeyMaterial reads -encrypt-key, which is file:<path> for a raw key,
+// passfile:<path> for a passphrase kept in a file or pass:<passphrase>.
+func loadKeyMaterial(spec string) (keyMaterial, error) {
+	var data []byte
+	switch {
+	case strings.HasPrefix(spec, keySpecFile):
+		raw, err := os.ReadFile(strings.TrimPrefix(spec, keySpecFile))
+		if err != nil {
+			return keyMaterial{}, fmt.Errorf("reading key file: %w", err)
+		}
+		if len(raw) == encryptKeySize {
+			return keyMaterial{raw: raw}, nil
+		}
+		if key, err := hex.DecodeString(strings.TrimSpace(string(raw))); err == nil && len(key) == encryptKeySize {
+			return keyMaterial{raw: key}, nil
+		}
+		return keyMaterial{}, fmt.Errorf("key file must hold %d raw bytes or %d hex digits, use %s for a passphrase file",
+			encryptKeySize, 2*encryptKeySize, keySpecPassFile)
+	case strings.HasPrefix(spec, keySpecPassFile):
+		var err error
+		if data, err = os.ReadFile(strings.TrimPrefix(spec, keySpecPassFile)); err != nil {
+			return keyMaterial{}, fmt.Errorf("reading passphrase file: %w", err)
+		}
+	case strings.HasPrefix(spec, keySpecPass):
+		data = []byte(strings.TrimPrefix(spec, keySpecPass))
+	default:
+		return keyMaterial{}, fmt.Errorf("expected %s<key file>, %s<passphrase file> or %s<passphrase>", keySpecFile, keySpecPassFile, keySpecPass)
+	}
+	
+	passphrase := bytes.TrimRight(data, "\r\n")
+	if len(passphrase) == 0 {
+		return keyMaterial{}, fmt.Errorf("empty passphrase")
+	}
+	return keyMaterial{passphrase: passphrase, derived: &sync.Map{}}, nil
+}
+
+// key returns the AES key for a file with the given mode and salt.
+func (m keyMaterial) key(mode byte, salt []byte) ([]byte, error) {
+	switch {
+	case mode == keyModeRaw && m.raw != nil:
+		return m.raw, nil
+	case mode == keyModePassphrase && m.passphrase != nil:
+		if key, ok := m.derived.Load(string(salt)); ok {
+			return key.([]byte), nil
+		}
+		key := pbkdf2SHA256(m.passphrase, salt, pbkdf2Iterations, encryptKeySize)
+		m.derived.Store(string(salt), key)
+		return key, nil
+	case mode == keyModeRaw:
+		return nil, fmt.Errorf("file was encrypted with a key file, not a passphrase")
+	case mode == keyModePassphrase:
+		return nil, fmt.Errorf("file was encrypted with a passphrase, not a key file")
+	}
+	return nil, fmt.Errorf("unknown key mode %d", mode)
+}
+
+// pbkdf2SHA256 is PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileEncryptor seals output files for -encrypt-key. With a passphrase
+// all files of a run share one salt, so the key is only derived once.
+type fileEncryptor struct {
+	mode byte
+	salt []byte
+	aead cipher.AEAD
+	// material reads back dumps of earlier runs, which have their own salt
+	material keyMaterial
+}
+
+func newFileEncryptor(spec string) (*fileEncryptor, error) {
+	material, err := loadKeyMaterial(spec)
+	if err != nil {
+		return nil, err
+	}
+	e := &fileEncryptor{mode: keyModeRaw, salt: make([]byte, encryptSaltSize), material: material}
+	if material.raw == nil {
+		e.mode = keyModePassphrase
+		if _, err := rand.Read(e.salt); err != nil {
+			return nil, fmt.Errorf("generating salt: %w", err)
+		}
+	}
+	key, err := material.key(e.mode, e.salt)
+	if err != nil {
+		return nil, err
+	}
+	if e.aead, err = newGCM(key); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// seal encrypts plaintext with a fresh nonce and returns the file content.
+func (e *fileEncryptor) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	header := make([]byte, 0, len(encryptedMagic)+1+len(e.salt)+len(nonce))
+	header = append(header, encryptedMagic...)
+	header = append(header, e.mode)
+	header = append(header, e.salt...)
+	header = append(header, nonce...)
+	return e.aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// decryptFile opens a file written with -encrypt-key, failing if it was
+// modified or the key is wrong.
+func decryptFile(data []byte, material keyMaterial) ([]byte, error) {
+	headerSize := len(encryptedMagic) + 1 + encryptSaltSize
+	if len(data) < headerSize || string(data[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, errNotEncrypted
+	}
+	mode := data[len(encryptedMagic)]
+	salt := data[len(encryptedMagic)+1 : headerSize]
+	key, err := material.key(mode, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	
+	headerSize += aead.NonceSize()
+	if len(data) < headerSize+aead.Overhead() {
+		return nil, fmt.Errorf("file is truncated")
+	}
+	header := data[:headerSize]
+	plaintext, err := aead.Open(nil, header[headerSize-aead.NonceSize():], data[headerSize:], header)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// runDecrypt runs -decrypt: it writes the plaintext of an encrypted output
+// file to w.
+func runDecrypt(path, keySpec string, w io.Writer) error {
+	if keySpec == "" {
+		return fmt.Errorf("-decrypt needs -encrypt-key")
+	}
+	material, err := loadKeyMaterial(keySpec)
+	if err != nil {
+		return fmt.Errorf("invalid -encrypt-key: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plaintext, err := decryptFile(data, material)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	_, err = w.Write(plaintext)
+	return err
+}
+
+// writtenName returns the name an output file is written under, with
+// encryptedSuffix when -encrypt-key is set.
+func (c *APIClient) writtenName(filename string) string {
+	if c.encryptor != nil {
+		return filename + encryptedSuffix
+	}
+	return filename
+}
+
+// dumpKey returns the key material to read earlier encrypted dumps with,
+// or nil without -encrypt-key.
+func (c *APIClient) dumpKey() *keyMaterial {
+	if c.encryptor == nil {
+		return nil
+	}
+	return &c.encryptor.material
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeKeyFile writes a hex key file and returns its -encrypt-key spec.
+func writeKeyFile(t *testing.T, key byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.hex")
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(bytes.Repeat([]byte{key}, encryptKeySize))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keySpecFile + path
+}
+
+func sealWith(t *testing.T, spec string, plaintext []byte) []byte {
+	t.Helper()
+	encryptor, err := newFileEncryptor(spec)
+	if err != nil {
+		t.Fatalf("newFileEncryptor(%q): %v", spec, err)
+	}
+	sealed, err := encryptor.seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func openWith(t *testing.T, spec string, sealed []byte) ([]byte, error) {
+	t.Helper()
+	material, err := loadKeyMaterial(spec)
+	if err != nil {
+		t.Fatalf("loadKeyMaterial(%q): %v", spec, err)
+	}
+	return decryptFile(sealed, material)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	plaintext := []byte(`{"data":[{"id":"1","name":"Campaign"}]}`)
+	for _, spec := range []string{writeKeyFile(t, 7), keySpecPass + "correct horse battery staple"} {
+		sealed := sealWith(t, spec, plaintext)
+		if bytes.Contains(sealed, plaintext) {
+			t.Errorf("%s: sealed file contains the plaintext", spec)
+		}
+		opened, err := openWith(t, spec, sealed)
+		if err != nil {
+			t.Fatalf("%s: decrypting: %v", spec, err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Errorf("%s: round trip = %q, want %q", spec, opened, plaintext)
+		}
+	}
+}
+
+func TestEncryptUsesFreshNonces(t *testing.T) {
+	spec := writeKeyFile(t, 1)
+	encryptor, err := newFileEncryptor(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := encryptor.seal([]byte("same"))
+	second, _ := encryptor.seal([]byte("same"))
+	if bytes.Equal(first, second) {
+		t.Error("sealing the same plaintext twice gave the same file")
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	spec := writeKeyFile(t, 2)
+	sealed := sealWith(t, spec, []byte(`{"spend":"12.50"}`))
+	headerSize := len(encryptedMagic) + 1 + encryptSaltSize
+	for name, offset := range map[string]int{
+		"salt":       len(encryptedMagic) + 1,
+		"nonce":      headerSize,
+		"ciphertext": len(sealed) - 20,
+		"tag":        len(sealed) - 1,
+	} {
+		tampered := append([]byte(nil), sealed...)
+		tampered[offset] ^= 0x01
+		if _, err := openWith(t, spec, tampered); err == nil {
+			t.Errorf("flipping a bit of the %s was not detected", name)
+		}
+	}
+	if _, err := openWith(t, spec, sealed[:len(sealed)-1]); err == nil {
+		t.Error("truncated file was not detected")
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	sealed := sealWith(t, writeKeyFile(t, 3), []byte("secret"))
+	if _, err := openWith(t, writeKeyFile(t, 4), sealed); err == nil {
+		t.Error("decrypting with another key succeeded")
+	}
+	if _, err := openWith(t, keySpecPass+"guess", sealed); err == nil {
+		t.Error("decrypting a key file's output with a passphrase succeeded")
+	}
+	
+	sealed = sealWith(t, keySpecPass+"right", []byte("secret"))
+	if _, err := openWith(t, keySpecPass+"wrong", sealed); err == nil {
+		t.Error("decrypting with the wrong passphrase succeeded")
+	}
+}
+
+func TestDecryptPlainFile(t *testing.T) {
+	_, err := openWith(t, writeKeyFile(t, 5), []byte(`{"data":[]}`))
+	if !errors.Is(err, errNotEncrypted) {
+		t.Errorf("err = %v, want errNotEncrypted", err)
+	}
+}
+
+func TestLoadKeyMaterialRequiresExplicitForm(t *testing.T) {
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(dir, "passphrase.txt")
+	if err := os.WriteFile(passphraseFile, []byte("from a file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	shortKey := filepath.Join(dir, "short.key")
+	if err := os.WriteFile(shortKey, []byte("too short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	
+	material, err := loadKeyMaterial(keySpecPassFile + passphraseFile)
+	if err != nil || string(material.passphrase) != "from a file" {
+		t.Errorf("passfile: got %q, %v", material.passphrase, err)
+	}
+	// Without a prefix, a mistyped key file path must not become the
+	// passphrase
+	for _, spec := range []string{
+		filepath.Join(dir, "missing.key"),
+		"hunter2",
+		keySpecFile + filepath.Join(dir, "missing.key"),
+		keySpecPassFile + filepath.Join(dir, "missing"),
+		keySpecFile + shortKey,
+		keySpecPass,
+	} {
+		if _, err := loadKeyMaterial(spec); err == nil {
+			t.Errorf("loadKeyMaterial(%q) succeeded", strings.TrimPrefix(spec, dir))
+		}
+	}
+}
+
+// TestPBKDF2SHA256 checks the PBKDF2-HMAC-SHA256 test vectors of RFC 7914
+// section 11.
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1,
+			"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000,
+			"4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 64))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestReadEncryptedDump(t *testing.T) {
+	spec := writeKeyFile(t, 6)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"data":[{"id":"1"},{"id":"2"}]}`))
+	gz.Close()
+	
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "campaigns_1700000000.json"), []byte(`{"data":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "campaigns_1800000000.json.gz"+encryptedSuffix)
+	if err := os.WriteFile(encrypted, sealWith(t, spec, compressed.Bytes()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	
+	if got := latestDump(dir, "campaigns"); got != encrypted {
+		t.Fatalf("latestDump = %q, want the encrypted dump %q", got, encrypted)
+	}
+	material, err := loadKeyMaterial(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readDumpRecords(encrypted, &material)
+	if err != nil {
+		t.Fatalf("reading encrypted dump: %v", err)
+	}
+	if ids := recordIDs(records); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("records = %v, want IDs 1 and 2", ids)
+	}
+	if _, err := readDumpRecords(encrypted, nil); err == nil {
+		t.Error("reading an encrypted dump without a key succeeded")
+	}
+}
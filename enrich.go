@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// enrichFields are the metadata fields -insights-enrich copies from a
+// campaign, ad set or ad into its insights rows, prefixed with the level
+// (adset_name, adset_daily_budget, ...).
+var enrichFields = []string{"name", "status", "daily_budget", "lifetime_budget"}
+
+// enrichInsights adds the metadata of the object each row belongs to, for
+// -insights-enrich at campaign, ad set or ad level. Rows whose object is not
+// among objects are left as they are and counted.
+func enrichInsights(rows, objects []json.RawMessage, level string) ([]json.RawMessage, int) {
+	byID := make(map[string]map[string]interface{}, len(objects))
+	for _, raw := range objects {
+		var object map[string]interface{}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			continue
+		}
+		if id, ok := object["id"].(string); ok {
+			byID[id] = object
+		}
+	}
+	
+	idKey := level + "_id"
+	missing := 0
+	for i, raw := range rows {
+		var row map[string]interface{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			continue
+		}
+		id, _ := row[idKey].(string)
+		object, ok := byID[id]
+		if !ok {
+			missing++
+			continue
+		}
+		for _, field := range enrichFields {
+			if value, ok := object[field]; ok {
+				row[level+"_"+field] = value
+			}
+		}
+		if enriched, err := json.Marshal(row); err == nil {
+			rows[i] = enriched
+		}
+	}
+	return rows, missing
+}
+
+// insightsLevelResource is the resource holding the objects insights rows
+// belong to at the given level, or "" at account level.
+func insightsLevelResource(level string) string {
+	switch level {
+	case "campaign":
+		return "campaigns"
+	case "adset":
+		return "adsets"
+	case "ad":
+		return "ads"
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envName maps a flag name to its environment variable, e.g. with prefix
+// FBADS_ the flag -max-pages becomes FBADS_MAX_PAGES.
+func envName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// bindEnv fills every flag that wasn't given on the command line from its
+// environment variable, so explicit flags always take precedence.
+func bindEnv(fs *flag.FlagSet, prefix string, skip ...string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for _, name := range skip {
+		explicit[name] = true
+	}
+	
+	var bindErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if bindErr != nil || explicit[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envName(prefix, f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			bindErr = fmt.Errorf("invalid %s: %w", envName(prefix, f.Name), err)
+		}
+	})
+	return bindErr
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const errorsFile = "errors.json"
+
+// runError is one failure of a run as written to errors.json. The Graph
+// API fields are set when the failure was an API error response.
+type runError struct {
+	Time      time.Time `json:"time"`
+	AccountID string    `json:"account_id,omitempty"`
+	Resource  string    `json:"resource,omitempty"` // empty when the whole account failed
+	Message   string    `json:"message"`
+	Status    int       `json:"status,omitempty"`
+	Code      int       `json:"code,omitempty"`
+	Subcode   int       `json:"subcode,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	FBTraceID string    `json:"fbtrace_id,omitempty"`
+}
+
+// errorLog collects the failures of all accounts for errors.json.
+type errorLog struct {
+	mu     sync.Mutex
+	errors []runError
+}
+
+func (l *errorLog) add(accountID, resource string, err error) {
+	entry := runError{
+		Time:      time.Now().UTC(),
+		AccountID: accountID,
+		Resource:  resource,
+		Message:   err.Error(),
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		entry.Status = apiErr.Status
+		entry.Code = apiErr.Code
+		entry.Subcode = apiErr.Subcode
+		entry.Type = apiErr.Type
+		entry.FBTraceID = apiErr.FBTraceID
+	}
+	
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, entry)
+}
+
+// write saves the collected errors, oldest first. An empty list is
+// written too, so a clean run is recognizable.
+func (l *errorLog) write(filename string, mode os.FileMode) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	errs := l.errors
+	if errs == nil {
+		errs = []runError{}
+	}
+	data, err := json.MarshalIndent(errs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding errors: %w", err)
+	}
+	if err := os.WriteFile(filename, data, mode); err != nil {
+		return fmt.Errorf("writing errors: %w", err)
+	}
+	return nil
+}
+
+// readErrors loads the errors.json of an earlier run. A missing file
+// yields no errors.
+func readErrors(path string) ([]runError, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading errors: %w", err)
+	}
+	var errs []runError
+	if err := json.Unmarshal(data, &errs); err != nil {
+		return nil, fmt.Errorf("parsing errors: %w", err)
+	}
+	return errs, nil
+}
+
+// mergeRetry folds the errors of an earlier run into the log of a
+// -retry-manifest run, the way mergeRetry does for the manifest: errors of
+// retried resources are replaced by the retry's own, and errors of an
+// account retried as a whole are dropped. Everything else is kept, ahead
+// of the new errors.
+func (l *errorLog) mergeRetry(previous []runError, retried map[string]map[string]bool) {
+	var kept []runError
+	for _, e := range previous {
+		if resources, ok := retried[e.AccountID]; ok && (e.Resource == "" || resources[e.Resource]) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(kept, l.errors...)
+}
+
+func (l *errorLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.errors)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestErrorLogMergeRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), errorsFile)
+	var first errorLog
+	first.add("act_1", "insights", errors.New("timeout"))
+	first.add("act_1", "pixels", errors.New("permission denied"))
+	first.add("act_2", "", errors.New("request limit reached"))
+	first.add("act_3", "ads", errors.New("unknown error"))
+	if err := first.write(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	
+	// The retry fetches act_1's insights again, and act_2 as a whole
+	// with the selected resources; act_1's pixels and act_3 weren't
+	// retried, say because -resources no longer selects them
+	var retry errorLog
+	retry.add("act_2", "ads", errors.New("still failing"))
+	previous, err := readErrors(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry.mergeRetry(previous, map[string]map[string]bool{
+		"act_1": {"insights": true},
+		"act_2": {"campaigns": true, "ads": true},
+	})
+	if err := retry.write(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	
+	merged, err := readErrors(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range merged {
+		got = append(got, e.AccountID+"/"+e.Resource+": "+e.Message)
+	}
+	want := []string{
+		"act_1/pixels: permission denied",
+		"act_3/ads: unknown error",
+		"act_2/ads: still failing",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged errors = %q, want %q", got, want)
+	}
+}
+
+func TestReadErrorsMissingFile(t *testing.T) {
+	errs, err := readErrors(filepath.Join(t.TempDir(), errorsFile))
+	if err != nil || errs != nil {
+		t.Errorf("readErrors of a missing file = %v, %v, want nothing", errs, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// fetchDeliveryEstimate returns the raw delivery_estimate response for a
+// single ad set. An empty optimizationGoal lets the API use the ad set's
+// own goal.
+func (c *APIClient) fetchDeliveryEstimate(adsetID, optimizationGoal string) (json.RawMessage, error) {
+	endpoint := adsetID + "/delivery_estimate"
+	if optimizationGoal != "" {
+		endpoint += "?optimization_goal=" + url.QueryEscape(optimizationGoal)
+	}
+	data, err := c.makeRequest(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	
+	var response struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("parsing delivery estimate: %w", err)
+	}
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("no delivery estimate returned")
+	}
+	return response.Data[0], nil
+}
+
+// fetchDeliveryEstimates dumps delivery_estimates.json keyed by ad set ID.
+// Ad sets the API refuses to estimate (paused, ended, unsupported goal) are
+// listed under "errors" instead of failing the whole resource.
+func (c *APIClient) fetchDeliveryEstimates(accountID string, adsets []json.RawMessage, accountDir string) (int, error) {
+	if adsets == nil {
+		var err error
+		adsets, err = c.fetchPaginated(fmt.Sprintf("%s/adsets?fields=id&limit=100", accountID), "adsets")
+		if err != nil {
+			return 0, fmt.Errorf("listing ad sets for delivery estimates: %w", err)
+		}
+	}
+	
+	ids := recordIDs(adsets)
+	if c.config.EstimateLimit > 0 && len(ids) > c.config.EstimateLimit {
+		c.logf("Sampling delivery estimates for the first %d of %d ad sets", c.config.EstimateLimit, len(ids))
+		ids = ids[:c.config.EstimateLimit]
+	}
+	
+	c.logf("Requesting: delivery estimates for %d ad sets", len(ids))
+	estimates := make(map[string]json.RawMessage)
+	failures := make(map[string]string)
+	for _, id := range ids {
+		estimate, err := c.fetchDeliveryEstimate(id, c.config.OptimizationGoal)
+		if err != nil {
+			c.logf("  No delivery estimate for ad set %s: %v", id, err)
+			failures[id] = err.Error()
+			continue
+		}
+		estimates[id] = estimate
+	}
+	
+	if len(estimates) == 0 && len(failures) > 0 {
+		return 0, fmt.Errorf("no ad set could be estimated (%d failures)", len(failures))
+	}
+	
+	aggregatedResponse := map[string]interface{}{
+		"data":   estimates,
+		"errors": failures,
+		"summary": map[string]interface{}{
+			"total_count":       len(estimates),
+			"failed_count":      len(failures),
+			"optimization_goal": c.config.OptimizationGoal,
+		},
+	}
+	
+	responseJSON, _ := json.Marshal(aggregatedResponse)
+	return len(estimates), c.dumpResponse("delivery_estimates", responseJSON, accountDir)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCampaignFields = "id,name,status,effective_status,objective,created_time,updated_time"
+	defaultAdSetFields    = "id,name,status,effective_status,campaign_id,daily_budget,lifetime_budget,created_time"
+	defaultAdFields       = "id,name,status,effective_status,adset_id,creative,created_time"
+)
+
+// fieldCache persists introspected field lists between runs. It only ever
+// holds one API version; a cache written for another version is discarded.
+// It is shared by the per-account clients, so access goes through lookup and
+// store.
+type fieldCache struct {
+	mu         sync.Mutex
+	APIVersion string                     `json:"api_version"`
+	Types      map[string]fieldCacheEntry `json:"types"`
+}
+
+type fieldCacheEntry struct {
+	Fields    []string  `json:"fields"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// defaultFieldCachePath returns the cache location under the user's cache
+// directory, or an empty string when there is none.
+func defaultFieldCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "facebook-ads-api-dumper", "fields.json")
+}
+
+func loadFieldCache(path, apiVersion string) *fieldCache {
+	cache := &fieldCache{APIVersion: apiVersion, Types: make(map[string]fieldCacheEntry)}
+	if path == "" {
+		return cache
+	}
+	
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: ignoring unreadable field cache: %v", err)
+		}
+		return cache
+	}
+	
+	var stored fieldCache
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("Warning: ignoring corrupt field cache: %v", err)
+		return cache
+	}
+	if stored.APIVersion != apiVersion {
+		log.Printf("Field cache is for API %s, re-introspecting for %s", stored.APIVersion, apiVersion)
+		return cache
+	}
+	if stored.Types != nil {
+		cache.Types = stored.Types
+	}
+	return cache
+}
+
+// lookup returns the cached fields of objectType if they are younger than ttl.
+func (fc *fieldCache) lookup(objectType string, ttl time.Duration) ([]string, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	entry, ok := fc.Types[objectType]
+	if !ok || time.Since(entry.FetchedAt) >= ttl {
+		return nil, false
+	}
+	return entry.Fields, true
+}
+
+// store caches the fields of objectType and writes the cache to path with
+// the -file-mode and -dir-mode permissions.
+func (fc *fieldCache) store(objectType string, fields []string, path string, fileMode, dirMode os.FileMode) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.Types[objectType] = fieldCacheEntry{Fields: fields, FetchedAt: time.Now()}
+	return fc.save(path, fileMode, dirMode)
+}
+
+func (fc *fieldCache) save(path string, fileMode, dirMode os.FileMode) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return fmt.Errorf("creating field cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding field cache: %w", err)
+	}
+	if err := os.WriteFile(path, data, fileMode); err != nil {
+		return fmt.Errorf("writing field cache: %w", err)
+	}
+	return nil
+}
+
+// introspectFields lists every field of an object type by asking the API
+// for the metadata of one existing object of that type.
+func (c *APIClient) introspectFields(objectID string) ([]string, error) {
+	data, err := c.makeRequest(objectID + "?metadata=1&fields=id")
+	if err != nil {
+		return nil, err
+	}
+	
+	var response struct {
+		Metadata struct {
+			Fields []struct {
+				Name string `json:"name"`
+			} `json:"fields"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("parsing metadata: %w", err)
+	}
+	
+	var fields []string
+	for _, field := range response.Metadata.Fields {
+		fields = append(fields, field.Name)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("metadata listed no fields")
+	}
+	return fields, nil
+}
+
+// resourceFields returns the field list to request for an edge. With
+// -fields-all it expands to every introspected field of objectType, served
+// from the cache while it is fresh; otherwise the defaults are used.
+func (c *APIClient) resourceFields(accountID, edge, objectType, defaults string) string {
+	if !c.config.FieldsAll {
+		return defaults
+	}
+	
+	if cached, ok := c.fieldCache.lookup(objectType, c.config.FieldsCacheTTL); ok {
+		return strings.Join(cached, ",")
+	}
+	
+	// Introspection needs one object of the type to ask about
+	sample, err := c.makeRequest(fmt.Sprintf("%s/%s?fields=id&limit=1", accountID, edge))
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err == nil {
+		err = json.Unmarshal(sample, &response)
+	}
+	if err != nil || len(response.Data) == 0 {
+		c.logf("Could not introspect %s fields, using defaults", objectType)
+		return defaults
+	}
+	
+	fields, err := c.introspectFields(response.Data[0].ID)
+	if err != nil {
+		c.logf("Could not introspect %s fields (%v), using defaults", objectType, err)
+		return defaults
+	}
+	c.logf("Introspected %d %s fields", len(fields), objectType)
+	
+	if err := c.fieldCache.store(objectType, fields, c.config.FieldsCachePath, c.config.FileMode, c.config.DirMode); err != nil {
+		c.logf("Warning: %v", err)
+	}
+	return strings.Join(fields, ",")
+}
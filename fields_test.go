@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFieldCacheUsesFileModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "fields.json")
+	fc := loadFieldCache(path, "v19.0")
+	if err := fc.store("campaign", []string{"id", "name"}, path, 0600, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{path: 0600, filepath.Dir(path): 0700} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != want {
+			t.Errorf("%s: mode = %o, want %o", filepath.Base(name), mode, want)
+		}
+	}
+	
+	reloaded := loadFieldCache(path, "v19.0")
+	if got := reloaded.Types["campaign"].Fields; !reflect.DeepEqual(got, []string{"id", "name"}) {
+		t.Errorf("reloaded fields = %v, want id and name", got)
+	}
+}
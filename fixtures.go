@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixture is one recorded request and its response. The access token is
+// removed from the URL, and every token in the form and the body is masked,
+// before anything is written, since fixtures get committed as test data.
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Form   string      `json:"form,omitempty"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"` // uncompressed response body
+}
+
+// fixtureKey identifies a request independent of the token and of query
+// parameter order, and names its fixture file.
+func fixtureKey(req *http.Request, form []byte) (string, string) {
+	u := *req.URL
+	query := u.Query()
+	query.Del("access_token")
+	u.RawQuery = query.Encode()
+	
+	sum := sha256.Sum256([]byte(req.Method + " " + u.String() + "\n" + string(form)))
+	return hex.EncodeToString(sum[:8]) + ".json", u.String()
+}
+
+// readRequestForm returns the body of a POST and restores it for sending.
+func readRequestForm(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	form, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(form))
+	return form, nil
+}
+
+// recordingTransport passes requests through and saves each exchange as a
+// fixture in dir, for -record-fixtures. Repeated requests overwrite their
+// fixture, so the last response wins.
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+func newRecordingTransport(dir string, next http.RoundTripper, dirMode os.FileMode) (*recordingTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, fmt.Errorf("creating fixtures directory: %w", err)
+	}
+	return &recordingTransport{next: next, dir: dir}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	form, err := readRequestForm(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	
+	// Tokens can only be masked in the uncompressed body, so the fixture is
+	// stored without Content-Encoding
+	header := redactHeaders(resp.Header, nil)
+	stored := body
+	if strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip body: %w", err)
+		}
+		stored, err = io.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("reading gzip body: %w", err)
+		}
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+	}
+	
+	name, cleanURL := fixtureKey(req, form)
+	data, _ := json.MarshalIndent(fixture{
+		Method: req.Method,
+		URL:    cleanURL,
+		Form:   string(redactTokens(form, "full")),
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   redactTokens(stored, "full"),
+	}, "", "  ")
+	if err := os.WriteFile(filepath.Join(t.dir, name), data, 0600); err != nil {
+		return nil, fmt.Errorf("writing fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// replayTransport answers requests from fixtures recorded by
+// recordingTransport instead of the network, for -replay-fixtures and for
+// tests. A request without a fixture fails.
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	form, err := readRequestForm(req)
+	if err != nil {
+		return nil, err
+	}
+	name, cleanURL := fixtureKey(req, form)
+	data, err := os.ReadFile(filepath.Join(t.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", req.Method, cleanURL, err)
+	}
+	var fx fixture
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return nil, fmt.Errorf("parsing fixture %s: %w", name, err)
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", fx.Status, http.StatusText(fx.Status)),
+		StatusCode: fx.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     fx.Header,
+		Body:       io.NopCloser(bytes.NewReader(fx.Body)),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	formatJSON    = "json"
+	formatCSV     = "csv"
+	formatNDJSON  = "ndjson"
+	formatParquet = "parquet"
+)
+
+// parseFormats validates a comma-separated -format value.
+func parseFormats(value string) ([]string, error) {
+	var formats []string
+	seen := make(map[string]bool)
+	for _, format := range splitList(value) {
+		switch format {
+		case formatJSON, formatCSV, formatNDJSON, formatParquet:
+		default:
+			return nil, fmt.Errorf("unknown format %q (want json, csv, ndjson or parquet)", format)
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no format selected")
+	}
+	return formats, nil
+}
+
+// outputFormats returns the formats to write, JSON unless configured.
+func (cfg Config) outputFormats() []string {
+	if len(cfg.Formats) == 0 {
+		return []string{formatJSON}
+	}
+	return cfg.Formats
+}
+
+// dumpRecords returns the records of a dump for the line-based formats:
+// the data array of an envelope, or the object itself for single-object
+// dumps such as ad_account.
+func dumpRecords(formatted []byte) ([]map[string]interface{}, error) {
+	var envelope struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(formatted, &envelope); err == nil && envelope.Data != nil {
+		return envelope.Data, nil
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(formatted, &record); err != nil {
+		return nil, fmt.Errorf("dump is not an object or a list of objects: %w", err)
+	}
+	return []map[string]interface{}{record}, nil
+}
+
+// writeCSVDump writes the records as <base>.csv. Columns are the union of
+// all top-level keys in sorted order; nested objects and arrays are
+// written as JSON in their cell.
+func (c *APIClient) writeCSVDump(base string, formatted []byte) error {
+	records, err := dumpRecords(formatted)
+	if err != nil {
+		return err
+	}
+	columnSet := make(map[string]bool)
+	for _, record := range records {
+		for key := range record {
+			columnSet[key] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for key := range columnSet {
+		columns = append(columns, key)
+	}
+	sort.Strings(columns)
+	
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns)
+	for _, record := range records {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			if value, ok := record[column]; ok && value != nil {
+				row[i] = jsonScalarString(value)
+			}
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	
+	filename, err := c.writeDumpOutput(base+".csv", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	c.logf("Saved to: %s", filename)
+	return nil
+}
+
+// writeNDJSONDump writes the records as <base>.ndjson, one object per line.
+func (c *APIClient) writeNDJSONDump(base string, formatted []byte) error {
+	records, err := dumpRecords(formatted)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	
+	filename, err := c.writeDumpOutput(base+".ndjson", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	c.logf("Saved to: %s", filename)
+	return nil
+}
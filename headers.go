@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerNamePattern matches an RFC 7230 header field name.
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// reservedHeaders are set by the client itself or by the transport and
+// can't be given with -header. Authentication goes through the
+// access_token parameter, so an Authorization header would only confuse
+// gateways in between.
+var reservedHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Authorization":     true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+}
+
+// headerFlag collects repeated -header key=value flags.
+type headerFlag struct {
+	header http.Header
+}
+
+func (h *headerFlag) String() string {
+	if h == nil || len(h.header) == 0 {
+		return ""
+	}
+	var pairs []string
+	for name, values := range h.header {
+		for _, value := range values {
+			pairs = append(pairs, name+"="+value)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (h *headerFlag) Set(entry string) error {
+	name, value, ok := strings.Cut(entry, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header %q is not key=value", entry)
+	}
+	if !headerNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("header %s: value must not contain line breaks", name)
+	}
+	name = http.CanonicalHeaderKey(name)
+	if reservedHeaders[name] {
+		return fmt.Errorf("header %s is set by the client and can't be overridden", name)
+	}
+	if h.header == nil {
+		h.header = make(http.Header)
+	}
+	h.header.Set(name, strings.TrimSpace(value))
+	return nil
+}
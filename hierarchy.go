@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// orphan is an object whose parent is missing from the dump.
+type orphan struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id"`
+}
+
+type hierarchyReport struct {
+	OrphanAdSets []orphan `json:"orphan_adsets"`
+	OrphanAds    []orphan `json:"orphan_ads"`
+}
+
+func (r hierarchyReport) count() int {
+	return len(r.OrphanAdSets) + len(r.OrphanAds)
+}
+
+// findOrphans returns the records whose parentKey doesn't match the id of
+// any parent record.
+func findOrphans(parents, children []json.RawMessage, parentKey string) []orphan {
+	known := make(map[string]bool)
+	for _, id := range recordIDs(parents) {
+		known[id] = true
+	}
+	
+	orphans := []orphan{}
+	for _, raw := range children {
+		var child map[string]interface{}
+		if err := json.Unmarshal(raw, &child); err != nil {
+			continue
+		}
+		id, _ := child["id"].(string)
+		parentID, _ := child[parentKey].(string)
+		if !known[parentID] {
+			orphans = append(orphans, orphan{ID: id, ParentID: parentID})
+		}
+	}
+	return orphans
+}
+
+// validateHierarchy checks that every ad set's campaign and every ad's ad
+// set were dumped for the account, which catches incomplete pulls.
+func validateHierarchy(campaigns, adsets, ads []json.RawMessage) hierarchyReport {
+	return hierarchyReport{
+		OrphanAdSets: findOrphans(campaigns, adsets, "campaign_id"),
+		OrphanAds:    findOrphans(adsets, ads, "adset_id"),
+	}
+}
+
+// checkHierarchy validates the dumped campaigns, ad sets and ads of an
+// account and writes hierarchy_validation.json when orphans are found.
+func (c *APIClient) checkHierarchy(entry *AccountManifest, campaigns, adsets, ads []json.RawMessage, accountDir string) {
+	for _, resource := range []string{"campaigns", "adsets", "ads"} {
+		if !entry.succeeded(resource) {
+			c.logf("Skipping hierarchy validation: %s were not fetched", resource)
+			return
+		}
+	}
+	
+	report := validateHierarchy(campaigns, adsets, ads)
+	entry.Orphans = report.count()
+	if report.count() == 0 {
+		c.logf("Hierarchy validation passed")
+		return
+	}
+	
+	c.logf("WARNING: hierarchy validation found %d ad sets without their campaign and %d ads without their ad set",
+		len(report.OrphanAdSets), len(report.OrphanAds))
+	for _, o := range report.OrphanAdSets {
+		c.logf("  Orphan ad set %s (campaign_id %s)", o.ID, o.ParentID)
+	}
+	for _, o := range report.OrphanAds {
+		c.logf("  Orphan ad %s (adset_id %s)", o.ID, o.ParentID)
+	}
+	
+	reportJSON, _ := json.Marshal(report)
+	if err := c.dumpResponse("hierarchy_validation", reportJSON, accountDir); err != nil {
+		c.logf("Error writing hierarchy validation: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// httpDumper writes each request and its response to numbered files for
+// debugging and for building fixtures. It is shared by all copies of a
+// client, so numbering is global to the run.
+type httpDumper struct {
+	dir       string
+	maxPairs  int
+	fileMode  os.FileMode
+	maskLevel string
+	// custom are the -header headers, masked like credentials
+	custom http.Header
+	
+	mu     sync.Mutex
+	count  int
+	warned bool
+}
+
+func newHTTPDumper(dir string, maxPairs int, config Config) (*httpDumper, error) {
+	if err := os.MkdirAll(dir, config.DirMode); err != nil {
+		return nil, fmt.Errorf("creating HTTP dump directory: %w", err)
+	}
+	return &httpDumper{dir: dir, maxPairs: maxPairs, fileMode: config.FileMode, maskLevel: config.MaskLevel, custom: config.Headers}, nil
+}
+
+// record writes NNN_request.txt and NNN_response.json. The URL must already
+// have its token masked; tokens in the body, such as those in paging.next
+// links, and credential headers are masked here. A nil resp records a
+// transport error instead.
+func (d *httpDumper) record(method, maskedURL string, reqHeader http.Header, resp *http.Response, body []byte, reqErr error) {
+	d.mu.Lock()
+	if d.maxPairs > 0 && d.count >= d.maxPairs {
+		if !d.warned {
+			log.Printf("HTTP dump limit (%d) reached, not recording further requests", d.maxPairs)
+			d.warned = true
+		}
+		d.mu.Unlock()
+		return
+	}
+	d.count++
+	n := d.count
+	d.mu.Unlock()
+	
+	var request strings.Builder
+	fmt.Fprintf(&request, "%s %s\n", method, maskedURL)
+	for name, values := range redactHeaders(reqHeader, d.custom) {
+		fmt.Fprintf(&request, "%s: %s\n", name, strings.Join(values, ", "))
+	}
+	
+	response := map[string]interface{}{}
+	if reqErr != nil {
+		response["error"] = reqErr.Error()
+	} else {
+		response["status"] = resp.StatusCode
+		response["headers"] = redactHeaders(resp.Header, nil)
+		body = redactTokens(body, d.maskLevel)
+		if json.Valid(body) {
+			response["body"] = json.RawMessage(body)
+		} else {
+			response["body"] = string(body)
+		}
+	}
+	responseJSON, _ := json.MarshalIndent(response, "", "  ")
+	
+	prefix := filepath.Join(d.dir, fmt.Sprintf("%03d", n))
+	if err := os.WriteFile(prefix+"_request.txt", []byte(request.String()), d.fileMode); err != nil {
+		log.Printf("Warning: writing HTTP dump: %v", err)
+		return
+	}
+	if err := os.WriteFile(prefix+"_response.json", responseJSON, d.fileMode); err != nil {
+		log.Printf("Warning: writing HTTP dump: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// identity is a Facebook Page or Instagram account an ad set promotes.
+type identity struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// adSetIdentity maps an ad set to the organic identities it runs under.
+type adSetIdentity struct {
+	Name      string    `json:"name"`
+	Page      *identity `json:"page,omitempty"`
+	Instagram *identity `json:"instagram,omitempty"`
+}
+
+// resolveIdentity looks up the display name of a page or Instagram
+// account, caching results since many ad sets share an identity. Names
+// that can't be read are left empty rather than failing the dump.
+func (c *APIClient) resolveIdentity(id, nameField string, cache map[string]string) *identity {
+	if name, ok := cache[id]; ok {
+		return &identity{ID: id, Name: name}
+	}
+	var name string
+	data, err := c.makeRequest(fmt.Sprintf("%s?fields=%s", id, nameField))
+	if err == nil {
+		var response map[string]interface{}
+		if json.Unmarshal(data, &response) == nil {
+			name, _ = response[nameField].(string)
+		}
+	} else {
+		c.logf("  Could not resolve identity %s: %v", id, err)
+	}
+	cache[id] = name
+	return &identity{ID: id, Name: name}
+}
+
+// fetchAdSetIdentities writes adset_identities.json, mapping each ad set
+// ID to the page and Instagram account of its promoted_object. Ad sets
+// without a promoted object are listed with no identity.
+func (c *APIClient) fetchAdSetIdentities(accountID string, accountDir string) (int, error) {
+	endpoint := fmt.Sprintf("%s/adsets?fields=id,name,promoted_object&limit=100", accountID)
+	adsets, err := c.fetchPaginated(endpoint, "adset identities")
+	if err != nil {
+		return 0, err
+	}
+	
+	identities := make(map[string]adSetIdentity)
+	cache := make(map[string]string)
+	for _, raw := range adsets {
+		var adset struct {
+			ID             string `json:"id"`
+			Name           string `json:"name"`
+			PromotedObject *struct {
+				PageID             string `json:"page_id"`
+				InstagramProfileID string `json:"instagram_profile_id"`
+			} `json:"promoted_object"`
+		}
+		if err := json.Unmarshal(raw, &adset); err != nil || adset.ID == "" {
+			continue
+		}
+		entry := adSetIdentity{Name: adset.Name}
+		if po := adset.PromotedObject; po != nil {
+			if po.PageID != "" {
+				entry.Page = c.resolveIdentity(po.PageID, "name", cache)
+			}
+			if po.InstagramProfileID != "" {
+				entry.Instagram = c.resolveIdentity(po.InstagramProfileID, "username", cache)
+			}
+		}
+		identities[adset.ID] = entry
+	}
+	
+	response := map[string]interface{}{
+		"data": identities,
+		"summary": map[string]interface{}{
+			"total_count": len(identities),
+		},
+	}
+	responseJSON, _ := json.Marshal(response)
+	return len(identities), c.dumpResponse("adset_identities", responseJSON, accountDir)
+}
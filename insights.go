@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	emptyInsightsEmpty  = "empty"
+	emptyInsightsMarker = "marker"
+	emptyInsightsSkip   = "skip"
+)
+
+// -strict-schema modes for the numeric insights fields.
+const (
+	strictSchemaOff  = "off"
+	strictSchemaWarn = "warn"
+	strictSchemaFail = "fail"
+)
+
+const defaultInsightsFields = "impressions,clicks,spend,ctr,cpc,date_start,date_stop"
+
+// knownInsightsFields are the fields the insights edge accepts, used to
+// catch typos in -insights-fields-append before any request is made.
+var knownInsightsFields = map[string]bool{
+	"account_currency": true, "account_id": true, "account_name": true,
+	"action_values": true, "actions": true, "ad_id": true, "ad_name": true,
+	"adset_id": true, "adset_name": true, "attribution_setting": true,
+	"buying_type": true, "campaign_id": true, "campaign_name": true,
+	"canvas_avg_view_percent": true, "canvas_avg_view_time": true,
+	"clicks": true, "conversion_rate_ranking": true, "conversion_values": true,
+	"conversions": true, "cost_per_action_type": true, "cost_per_conversion": true,
+	"cost_per_inline_link_click": true, "cost_per_inline_post_engagement": true,
+	"cost_per_outbound_click": true, "cost_per_thruplay": true,
+	"cost_per_unique_action_type": true, "cost_per_unique_click": true,
+	"cost_per_unique_inline_link_click": true, "cost_per_unique_outbound_click": true,
+	"cpc": true, "cpm": true, "cpp": true, "ctr": true,
+	"date_start": true, "date_stop": true, "engagement_rate_ranking": true,
+	"estimated_ad_recall_rate": true, "estimated_ad_recallers": true,
+	"frequency": true, "full_view_impressions": true, "full_view_reach": true,
+	"impressions": true, "inline_link_click_ctr": true, "inline_link_clicks": true,
+	"inline_post_engagement": true, "instant_experience_clicks_to_open": true,
+	"objective": true, "optimization_goal": true, "outbound_clicks": true,
+	"outbound_clicks_ctr": true, "purchase_roas": true, "quality_ranking": true,
+	"reach": true, "social_spend": true, "spend": true, "unique_actions": true,
+	"unique_clicks": true, "unique_ctr": true, "unique_inline_link_click_ctr": true,
+	"unique_inline_link_clicks": true, "unique_link_clicks_ctr": true,
+	"unique_outbound_clicks": true, "video_30_sec_watched_actions": true,
+	"video_avg_time_watched_actions": true, "video_p100_watched_actions": true,
+	"video_p25_watched_actions": true, "video_p50_watched_actions": true,
+	"video_p75_watched_actions": true, "video_p95_watched_actions": true,
+	"video_play_actions": true, "website_ctr": true, "website_purchase_roas": true,
+}
+
+// numericInsightsFields are the insights fields holding a single number,
+// which the API returns as strings. -strict-schema writes them as JSON
+// numbers; action breakdowns such as actions are lists and left alone.
+var numericInsightsFields = map[string]bool{
+	"canvas_avg_view_percent": true, "canvas_avg_view_time": true, "clicks": true,
+	"cost_per_inline_link_click": true, "cost_per_inline_post_engagement": true,
+	"cost_per_unique_click": true, "cost_per_unique_inline_link_click": true,
+	"cpc": true, "cpm": true, "cpp": true, "ctr": true,
+	"estimated_ad_recall_rate": true, "estimated_ad_recallers": true,
+	"frequency": true, "full_view_impressions": true, "full_view_reach": true,
+	"impressions": true, "inline_link_click_ctr": true, "inline_link_clicks": true,
+	"inline_post_engagement": true, "instant_experience_clicks_to_open": true,
+	"reach": true, "social_spend": true, "spend": true, "unique_clicks": true,
+	"unique_ctr": true, "unique_inline_link_click_ctr": true,
+	"unique_inline_link_clicks": true, "unique_link_clicks_ctr": true,
+}
+
+// unavailableFieldPatterns match the Graph API messages naming a field
+// that can't be requested, e.g. "(#100) cpp is not valid for fields param".
+var unavailableFieldPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(\w+) is not valid for fields param`),
+	regexp.MustCompile(`[Ff]ield '?(\w+)'? (?:is not|isn't) (?:supported|available)`),
+	regexp.MustCompile(`[Ii]nvalid (?:field|value)s?:? '?(\w+)'?`),
+}
+
+// unavailableInsightsField returns the requested field that the insights
+// error complains about, or "" when err isn't such an error.
+func unavailableInsightsField(err error, fields []string) string {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Code != 100 {
+		return ""
+	}
+	for _, pattern := range unavailableFieldPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(apiErr.Message, -1) {
+			for _, field := range fields {
+				if field == match[1] {
+					return field
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func removeField(fields []string, field string) []string {
+	kept := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f != field {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// insightsFieldList returns the default insights fields followed by the
+// extra fields, without duplicates. Unknown extra fields are an error.
+func insightsFieldList(extra string) (string, error) {
+	if err := checkInsightsFields(extra); err != nil {
+		return "", err
+	}
+	return dedupeFields(append(splitList(defaultInsightsFields), splitList(extra)...)), nil
+}
+
+func checkInsightsFields(list string) error {
+	var unknown []string
+	for _, field := range splitList(list) {
+		if !knownInsightsFields[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown insights field(s): %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func dedupeFields(list []string) string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, field := range list {
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// parseLevelInsightsFields parses -insights-fields, a whitespace-separated
+// list of level=fields entries such as
+// "account=spend,impressions ad=spend,impressions,ctr,actions". The
+// fields of an entry replace the default set for that level. A plain
+// comma-separated list without entries applies to every level.
+func parseLevelInsightsFields(spec string) (map[string]string, error) {
+	levels := make(map[string]string)
+	if strings.TrimSpace(spec) != "" && !strings.Contains(spec, "=") {
+		if err := checkInsightsFields(spec); err != nil {
+			return nil, err
+		}
+		for _, level := range []string{"account", "campaign", "adset", "ad"} {
+			levels[level] = dedupeFields(splitList(spec))
+		}
+		return levels, nil
+	}
+	for _, entry := range strings.Fields(spec) {
+		level, list, ok := strings.Cut(entry, "=")
+		if !ok || list == "" {
+			return nil, fmt.Errorf("entry %q is not level=field,field", entry)
+		}
+		switch level {
+		case "account", "campaign", "adset", "ad":
+		default:
+			return nil, fmt.Errorf("unknown level %q (expected account, campaign, adset, or ad)", level)
+		}
+		if _, dup := levels[level]; dup {
+			return nil, fmt.Errorf("level %q given more than once", level)
+		}
+		if err := checkInsightsFields(list); err != nil {
+			return nil, fmt.Errorf("level %s: %w", level, err)
+		}
+		levels[level] = dedupeFields(splitList(list))
+	}
+	return levels, nil
+}
+
+// levelInsightsFields returns the comma-separated fields to request for
+// -level: the -insights-fields entry for it, or the defaults plus
+// -insights-fields-append.
+func (cfg Config) levelInsightsFields() string {
+	if fields, ok := cfg.LevelInsightsFields[cfg.InsightsLevel]; ok {
+		return fields
+	}
+	return cfg.InsightsFields
+}
+
+// dateRange is an inclusive YYYY-MM-DD insights time range.
+type dateRange struct {
+	Since string
+	Until string
+}
+
+// timeRange renders the range as the JSON the time_range parameter takes.
+func (r dateRange) timeRange() string {
+	data, _ := json.Marshal(map[string]string{"since": r.Since, "until": r.Until})
+	return string(data)
+}
+
+// defaultInsightsRange returns the defaultInsightsDays full days (UTC)
+// before now, ending yesterday.
+func defaultInsightsRange(now time.Time) (string, string) {
+	until := now.UTC().AddDate(0, 0, -1)
+	since := until.AddDate(0, 0, -(defaultInsightsDays - 1))
+	return since.Format(dateLayout), until.Format(dateLayout)
+}
+
+// insightsRangeOrDefault fills in the defaults for an empty since or
+// until.
+func insightsRangeOrDefault(since, until string, now time.Time) (string, string) {
+	defaultSince, defaultUntil := defaultInsightsRange(now)
+	if since == "" {
+		since = defaultSince
+	}
+	if until == "" {
+		until = defaultUntil
+	}
+	return since, until
+}
+
+// splitDateRange cuts since..until into consecutive windows of at most
+// chunkDays days. A chunkDays of 0 or less returns the range unchanged.
+func splitDateRange(since, until string, chunkDays int) ([]dateRange, error) {
+	start, err := time.Parse(dateLayout, since)
+	if err != nil {
+		return nil, fmt.Errorf("invalid since date %q: %w", since, err)
+	}
+	end, err := time.Parse(dateLayout, until)
+	if err != nil {
+		return nil, fmt.Errorf("invalid until date %q: %w", until, err)
+	}
+	if chunkDays <= 0 {
+		return []dateRange{{Since: since, Until: until}}, nil
+	}
+	
+	var windows []dateRange
+	for !start.After(end) {
+		windowEnd := start.AddDate(0, 0, chunkDays-1)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+		windows = append(windows, dateRange{
+			Since: start.Format(dateLayout),
+			Until: windowEnd.Format(dateLayout),
+		})
+		start = windowEnd.AddDate(0, 0, 1)
+	}
+	return windows, nil
+}
+
+// segmentsInsights reports whether the insights query multiplies rows
+// (finer level, breakdowns or a time increment) and therefore benefits
+// from being split into smaller time windows.
+func (c *APIClient) segmentsInsights() bool {
+	return c.config.InsightsLevel != "account" || c.config.Breakdowns != "" || c.config.TimeIncrement != ""
+}
+
+// summedInsightsMetrics are added up across rows by -aggregate-insights.
+var summedInsightsMetrics = []string{"impressions", "clicks", "spend"}
+
+// parseMetric reads an insights metric, which the API returns as a string
+// (and occasionally as a number). Missing or blank values count as zero.
+func parseMetric(v interface{}) (float64, error) {
+	switch value := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return value, nil
+	case string:
+		if value == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(value, 64)
+	}
+	return 0, fmt.Errorf("unexpected metric type %T", v)
+}
+
+// coerceNumber returns the JSON number for a numeric insights value. Blank
+// strings become null; ok is false for anything that isn't a number.
+func coerceNumber(raw json.RawMessage) (json.RawMessage, bool) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, false
+	}
+	switch value := v.(type) {
+	case nil, float64:
+		return raw, true
+	case string:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return json.RawMessage("null"), true
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+			return nil, false
+		}
+		return json.RawMessage(strconv.FormatFloat(number, 'f', -1, 64)), true
+	}
+	return nil, false
+}
+
+// applyStrictSchema rewrites the numericInsightsFields of every row as JSON
+// numbers for -strict-schema. In fail mode the first value that doesn't
+// parse is an error; in warn mode it is written as null and reported in
+// the returned problems, one entry per row.
+func applyStrictSchema(rows []json.RawMessage, mode string) ([]json.RawMessage, []string, error) {
+	var problems []string
+	for i, raw := range rows {
+		var row map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return nil, nil, fmt.Errorf("parsing insights row %d: %w", i, err)
+		}
+		var invalid []string
+		for field, value := range row {
+			if !numericInsightsFields[field] {
+				continue
+			}
+			number, ok := coerceNumber(value)
+			if !ok {
+				if mode == strictSchemaFail {
+					return nil, nil, fmt.Errorf("insights row %d: %s is not a number: %s", i, field, value)
+				}
+				invalid = append(invalid, fmt.Sprintf("%s=%s", field, value))
+				number = json.RawMessage("null")
+			}
+			row[field] = number
+		}
+		if len(invalid) > 0 {
+			sort.Strings(invalid)
+			problems = append(problems, fmt.Sprintf("row %d: %s", i, strings.Join(invalid, ", ")))
+		}
+		coerced, err := json.Marshal(row)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encoding insights row %d: %w", i, err)
+		}
+		rows[i] = coerced
+	}
+	return rows, problems, nil
+}
+
+// filterMinImpressions drops the rows with fewer than min impressions,
+// for -min-impressions. Rows without impressions count as zero. It returns
+// the kept rows and the number dropped.
+func filterMinImpressions(rows []json.RawMessage, min int64) ([]json.RawMessage, int, error) {
+	kept := rows[:0]
+	for i, raw := range rows {
+		var row struct {
+			Impressions interface{} `json:"impressions"`
+		}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return nil, 0, fmt.Errorf("parsing insights row %d: %w", i, err)
+		}
+		impressions, err := parseMetric(row.Impressions)
+		if err != nil {
+			return nil, 0, fmt.Errorf("insights row %d: invalid impressions: %w", i, err)
+		}
+		if impressions >= float64(min) {
+			kept = append(kept, raw)
+		}
+	}
+	return kept, len(rows) - len(kept), nil
+}
+
+// insightsTotals sums the numeric metrics over all rows and recomputes the
+// derived ratios from the sums, since averaging per-row CTR or CPC would
+// weight every day equally. Ratios with a zero denominator are omitted.
+func insightsTotals(rows []json.RawMessage) (map[string]interface{}, error) {
+	sums := make(map[string]float64)
+	for i, raw := range rows {
+		var row map[string]interface{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return nil, fmt.Errorf("parsing insights row %d: %w", i, err)
+		}
+		for _, metric := range summedInsightsMetrics {
+			value, err := parseMetric(row[metric])
+			if err != nil {
+				return nil, fmt.Errorf("insights row %d: invalid %s: %w", i, metric, err)
+			}
+			sums[metric] += value
+		}
+	}
+	
+	totals := map[string]interface{}{
+		"rows": len(rows),
+	}
+	for _, metric := range summedInsightsMetrics {
+		totals[metric] = sums[metric]
+	}
+	if sums["impressions"] > 0 {
+		totals["ctr"] = sums["clicks"] / sums["impressions"] * 100
+	}
+	if sums["clicks"] > 0 {
+		totals["cpc"] = sums["spend"] / sums["clicks"]
+	}
+	return totals, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// cycleDirLayout names the per-cycle subdirectories of -interval.
+const cycleDirLayout = "20060102T150405Z"
+
+// runPeriodically runs a dump every interval until interrupted, for
+// -interval. A failed cycle is logged and the next one runs as planned,
+// so a transient outage doesn't end the daemon. The first SIGINT or
+// SIGTERM ends the loop once the running cycle is done (or right away
+// while waiting); a second one exits immediately.
+func runPeriodically(client *APIClient, interval time.Duration, run func(*APIClient) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		// Restore the default handling so a second signal exits
+		signal.Stop(signals)
+		log.Println("Interrupted, stopping after the current cycle (interrupt again to exit now)")
+		cancel()
+	}()
+	
+	for cycle := 1; ; cycle++ {
+		cycleClient, err := client.forCycle(time.Now())
+		if err != nil {
+			fatalf("Failed to prepare cycle %d: %v", cycle, err)
+		}
+		started := time.Now()
+		log.Printf("Cycle %d started, writing to: %s", cycle, cycleClient.config.OutputDir)
+		if err := run(cycleClient); err != nil {
+			log.Printf("ERROR: cycle %d failed after %v: %v", cycle, time.Since(started).Round(time.Second), err)
+		} else {
+			log.Printf("Cycle %d finished in %v", cycle, time.Since(started).Round(time.Second))
+		}
+		
+		if client.abort.aborted() {
+			log.Println("Stopping -interval: the access token is no longer valid")
+			return
+		}
+		log.Printf("Next cycle in %v", interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// forCycle returns a copy of the client for one -interval cycle. Each
+// cycle gets its own run ID, a fresh request budget and, unless -merge-existing or
+// -incremental carry state between runs, its own timestamped
+// subdirectory of the output directory.
+func (c *APIClient) forCycle(now time.Time) (*APIClient, error) {
+	clone := *c
+	clone.config.RunID = newRunID(now)
+	clone.requests = &requestBudget{max: int64(c.config.MaxRequests)}
+	clone.downloads = &byteBudget{max: c.config.MaxBytes}
+	c.limiter.resetPeaks()
+	clone.errors = &errorLog{}
+	if c.config.OutputDir != "" && !c.config.MergeExisting && !c.config.Incremental {
+		clone.config.OutputDir = filepath.Join(c.config.OutputDir, now.UTC().Format(cycleDirLayout))
+		if err := os.MkdirAll(clone.config.OutputDir, c.config.DirMode); err != nil {
+			return nil, err
+		}
+	}
+	if c.combined != nil {
+		clone.combined = newCombinedCSV(clone.config.OutputDir)
+	}
+	if c.compressed != nil {
+		clone.compressed = newCompressedFiles(clone.config.OutputDir)
+	}
+	if c.checksums != nil {
+		clone.checksums = newChecksumRecorder(clone.config.OutputDir)
+	}
+	return &clone, nil
+}
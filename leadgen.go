@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Page is a Facebook Page the token manages, with its page access token.
+type Page struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	AccessToken string `json:"access_token"`
+}
+
+// withToken returns a copy of the client that authenticates with a
+// different access token, such as a page token.
+func (c *APIClient) withToken(token string) *APIClient {
+	clone := *c
+	clone.config.AccessToken = token
+	clone.tokens = StaticTokenProvider{AccessToken: token}
+	clone.pageToken = true
+	return &clone
+}
+
+func (c *APIClient) fetchPages() ([]Page, error) {
+	c.logf("Requesting: me/accounts (pages)")
+	allData, err := c.fetchPaginated("me/accounts?fields=id,name,access_token&limit=100", "pages")
+	if err != nil {
+		return nil, err
+	}
+	
+	var pages []Page
+	for _, raw := range allData {
+		var page Page
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, fmt.Errorf("parsing page: %w", err)
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// fetchLeadgenForms lists the lead forms of a page. The page client must
+// use the page's own access token.
+func (c *APIClient) fetchLeadgenForms(pageID string) ([]json.RawMessage, error) {
+	endpoint := fmt.Sprintf("%s/leadgen_forms?fields=id,name,status,locale,leads_count,created_time&limit=100", pageID)
+	return c.fetchPaginated(endpoint, "leadgen_forms")
+}
+
+// fetchLeads lists the submitted leads of a form. Leads are personal data.
+func (c *APIClient) fetchLeads(formID string) ([]json.RawMessage, error) {
+	endpoint := fmt.Sprintf("%s/leads?fields=id,created_time,ad_id,form_id,field_data&limit=100", formID)
+	return c.fetchPaginated(endpoint, "leads")
+}
+
+// dumpLeadgen writes leadgen_forms.json, and leads_<form>.json with
+// -include-leads, for every page the token manages.
+func (c *APIClient) dumpLeadgen() error {
+	if c.config.IncludeLeads {
+		log.Println("WARNING: -include-leads is set, lead submissions (personal data) will be written to the dump")
+	}
+	
+	pages, err := c.fetchPages()
+	if err != nil {
+		return fmt.Errorf("fetching pages: %w", err)
+	}
+	c.logf("Found %d page(s) for lead forms", len(pages))
+	
+	for _, page := range pages {
+		if page.AccessToken == "" {
+			c.logf("Skipping page %s: no page access token (missing pages_manage_ads or leads_retrieval?)", page.Name)
+			continue
+		}
+		pageClient := c.withToken(page.AccessToken)
+		
+		var pageDir string
+		if c.config.OutputDir != "" {
+			dirName := page.ID
+			if safeName := sanitizeName(page.Name, c.config.NameSanitize); safeName != "" {
+				dirName = fmt.Sprintf("%s_%s", page.ID, safeName)
+			}
+			pageDir = filepath.Join(c.config.OutputDir, "pages", dirName)
+			if err := os.MkdirAll(pageDir, c.config.DirMode); err != nil {
+				return fmt.Errorf("creating page directory: %w", err)
+			}
+		}
+		
+		forms, err := pageClient.fetchLeadgenForms(page.ID)
+		if err != nil {
+			c.logf("Error fetching lead forms for page %s: %v", page.Name, err)
+			continue
+		}
+		
+		aggregatedResponse := map[string]interface{}{
+			"data": forms,
+			"summary": map[string]interface{}{
+				"total_count": len(forms),
+			},
+		}
+		responseJSON, _ := json.Marshal(aggregatedResponse)
+		if err := c.dumpResponse("leadgen_forms", responseJSON, pageDir); err != nil {
+			return err
+		}
+		
+		if !c.config.IncludeLeads {
+			continue
+		}
+		for _, formID := range recordIDs(forms) {
+			leads, err := pageClient.fetchLeads(formID)
+			if err != nil {
+				c.logf("Error fetching leads for form %s: %v", formID, err)
+				continue
+			}
+			aggregatedResponse := map[string]interface{}{
+				"data": leads,
+				"summary": map[string]interface{}{
+					"total_count": len(leads),
+				},
+			}
+			responseJSON, _ := json.Marshal(aggregatedResponse)
+			if err := c.dumpResponse("leads_"+formID, responseJSON, pageDir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// setupLogFile tees the standard logger to stderr and the given file,
+// created with -file-mode. When appending is off, an existing log is
+// rotated to <path>.1 first so the previous run's log is kept.
+func setupLogFile(path string, appendLog bool, mode os.FileMode) (*os.File, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !appendLog {
+		if err := os.Rename(path, path+".1"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("rotating log file: %w", err)
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	
+	file, err := os.OpenFile(path, flags, mode)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	return file, nil
+}
+
+const (
+	logModeAuto     = "auto"
+	logModeStream   = "stream"
+	logModeBuffered = "buffered"
+	logModePrefixed = "prefixed"
+)
+
+// logFlushMu keeps flushed account logs from interleaving with each other.
+var logFlushMu sync.Mutex
+
+// resolveLogMode picks the account log mode. "auto" buffers account logs
+// when several accounts are processed concurrently and streams otherwise.
+func resolveLogMode(mode string, concurrency int) (string, error) {
+	switch mode {
+	case logModeAuto:
+		if concurrency > 1 {
+			return logModeBuffered, nil
+		}
+		return logModeStream, nil
+	case logModeStream, logModeBuffered, logModePrefixed:
+		return mode, nil
+	}
+	return "", fmt.Errorf("must be auto, stream, buffered or prefixed, got %q", mode)
+}
+
+// logf logs through the client's account logger, or the standard logger
+// outside an account.
+func (c *APIClient) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// startAccountLog sets up the client's logger for one account according to
+// -log-mode. "buffered" collects the account's lines and writes them as one
+// block when the returned flush function is called; "prefixed" tags each
+// line with the account ID as it is written.
+func (c *APIClient) startAccountLog(accountID string) (flush func()) {
+	switch c.config.LogMode {
+	case logModeBuffered:
+		var buf bytes.Buffer
+		if jsonLog != nil {
+			// Lines are encoded as they are logged, so they keep the time
+			// they happened at rather than the time of the flush
+			c.logger = log.New(&jsonLogWriter{out: &buf}, "", log.Flags())
+			return func() {
+				logFlushMu.Lock()
+				defer logFlushMu.Unlock()
+				jsonLog.writeEncoded(buf.Bytes())
+			}
+		}
+		c.logger = log.New(&buf, "", log.Flags())
+		return func() {
+			logFlushMu.Lock()
+			defer logFlushMu.Unlock()
+			log.Writer().Write(buf.Bytes())
+		}
+	case logModePrefixed:
+		c.logger = log.New(log.Writer(), "["+accountID+"] ", log.Flags()|log.Lmsgprefix)
+	}
+	return func() {}
+}
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// jsonLogWriter turns the standard logger's output into one JSON object
+// per line for -log-format json. The level is derived from the usual
+// WARNING and ERROR prefixes of the message, after the account prefix of
+// -log-mode prefixed.
+type jsonLogWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// jsonLog is set when -log-format json is active, so fatal errors are
+// reported as JSON too.
+var jsonLog *jsonLogWriter
+
+func (w *jsonLogWriter) Write(p []byte) (int, error) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, line := range strings.Split(string(p), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := w.emit(map[string]interface{}{
+			"time":  now,
+			"level": logLevel(line),
+			"msg":   line,
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// logLevel classifies a log line by the first word of its message, after
+// an account prefix such as "[act_123] ": "Warning" and "Error" in any
+// case, as in "WARNING: ..." or "Error fetching ads: ...".
+func logLevel(line string) string {
+	msg := line
+	if strings.HasPrefix(msg, "[act_") {
+		if i := strings.Index(msg, "] "); i >= 0 {
+			msg = msg[i+2:]
+		}
+	}
+	word := msg
+	if i := strings.IndexFunc(msg, func(r rune) bool { return !unicode.IsLetter(r) }); i >= 0 {
+		word = msg[:i]
+	}
+	switch {
+	case strings.EqualFold(word, "warning"):
+		return "warn"
+	case strings.EqualFold(word, "error"):
+		return "error"
+	}
+	return "info"
+}
+
+// writeEncoded writes lines another jsonLogWriter already encoded.
+func (w *jsonLogWriter) writeEncoded(p []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(p)
+	return err
+}
+
+func (w *jsonLogWriter) emit(record map[string]interface{}) error {
+	data, _ := json.Marshal(record)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(append(data, '\n'))
+	return err
+}
+
+// setupJSONLog switches the standard logger to JSON lines.
+func setupJSONLog() {
+	jsonLog = &jsonLogWriter{out: log.Writer()}
+	log.SetFlags(0)
+	log.SetOutput(jsonLog)
+}
+
+// fatal logs a message and exits with status 1 like log.Fatal. With
+// -log-format json the last line is a structured
+// {"level":"fatal","error":...,"exit_code":1} object an orchestrator can
+// parse.
+func fatal(v ...interface{}) {
+	exitFatal(fmt.Sprint(v...))
+}
+
+// fatalf is the formatting variant of fatal.
+func fatalf(format string, v ...interface{}) {
+	exitFatal(fmt.Sprintf(format, v...))
+}
+
+func exitFatal(msg string) {
+	const exitCode = 1
+	if jsonLog == nil {
+		log.Output(3, msg)
+		os.Exit(exitCode)
+	}
+	jsonLog.emit(map[string]interface{}{
+		"time":      time.Now().UTC().Format(time.RFC3339Nano),
+		"level":     "fatal",
+		"error":     msg,
+		"exit_code": exitCode,
+	})
+	os.Exit(exitCode)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withJSONLog routes the standard logger through a jsonLogWriter into a
+// buffer for the duration of the test.
+func withJSONLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var out bytes.Buffer
+	savedWriter, savedFlags, savedJSON := log.Writer(), log.Flags(), jsonLog
+	jsonLog = &jsonLogWriter{out: &out}
+	log.SetFlags(0)
+	log.SetOutput(jsonLog)
+	t.Cleanup(func() {
+		jsonLog = savedJSON
+		log.SetFlags(savedFlags)
+		log.SetOutput(savedWriter)
+	})
+	return &out
+}
+
+type jsonLine struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Msg   string    `json:"msg"`
+}
+
+func jsonLines(t *testing.T, out *bytes.Buffer) []jsonLine {
+	t.Helper()
+	var lines []jsonLine
+	for _, raw := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var line jsonLine
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct{ line, want string }{
+		{"Fetched 12 campaigns", "info"},
+		{"WARNING: request limit almost reached", "warn"},
+		{"ERROR: cycle 2 failed", "error"},
+		{"[act_123] WARNING: token expires soon", "warn"},
+		{"[act_123] ERROR: account failed", "error"},
+		{"[act_123] Fetched 3 ads", "info"},
+		{"[DEBUG] Request URL: https://graph.facebook.com/v19.0/me", "info"},
+		{"Error fetching ads: request failed", "error"},
+		{"[act_123] Error processing account Acme: timeout", "error"},
+		{"Warning: Invalid JSON from campaigns", "warn"},
+		{"[act_123] warning: ignoring corrupt field cache", "warn"},
+		{"Errors are saved to errors.json", "info"},
+		{"Request error [network]: timeout", "info"},
+		{"Code 17 is in -retry-codes, waiting 1s before retry...", "info"},
+	}
+	for _, tt := range tests {
+		if got := logLevel(tt.line); got != tt.want {
+			t.Errorf("logLevel(%q) = %s, want %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestJSONLogPrefixedAccountLevels(t *testing.T) {
+	out := withJSONLog(t)
+	client := &APIClient{config: Config{LogMode: logModePrefixed}}
+	client.startAccountLog("act_7")()
+	client.logf("WARNING: something is off")
+	client.logf("Error fetching ads: request failed")
+	
+	lines := jsonLines(t, out)
+	if len(lines) != 2 || lines[0].Level != "warn" || lines[0].Msg != "[act_7] WARNING: something is off" {
+		t.Fatalf("logged %+v, want a warn line with the account prefix first", lines)
+	}
+	if lines[1].Level != "error" {
+		t.Errorf("%q logged at level %s, want error", lines[1].Msg, lines[1].Level)
+	}
+}
+
+func TestJSONLogBufferedKeepsLineTime(t *testing.T) {
+	out := withJSONLog(t)
+	client := &APIClient{config: Config{LogMode: logModeBuffered}}
+	flush := client.startAccountLog("act_7")
+	client.logf("ERROR: first")
+	logged := time.Now()
+	time.Sleep(50 * time.Millisecond)
+	client.logf("second")
+	if out.Len() != 0 {
+		t.Fatalf("buffered lines were written before the flush: %s", out)
+	}
+	flush()
+	
+	lines := jsonLines(t, out)
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %s", len(lines), out)
+	}
+	if lines[0].Msg != "ERROR: first" || lines[0].Level != "error" {
+		t.Errorf("first line = %+v, want the error as logged", lines[0])
+	}
+	if lines[0].Time.After(logged) {
+		t.Errorf("first line has time %v, after it was logged at %v", lines[0].Time, logged)
+	}
+	if !lines[1].Time.After(lines[0].Time) {
+		t.Errorf("lines have times %v and %v, want the time each was logged", lines[0].Time, lines[1].Time)
+	}
+}
+
+func TestSetupLogFileUsesFileMode(t *testing.T) {
+	saved := log.Writer()
+	t.Cleanup(func() { log.SetOutput(saved) })
+	
+	path := filepath.Join(t.TempDir(), "run.log")
+	for _, appendLog := range []bool{false, true} {
+		os.Remove(path)
+		file, err := setupLogFile(path, appendLog, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("append %v: log file mode = %o, want 600", appendLog, mode)
+		}
+	}
+}
@@ -1,29 +1,136 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
-	baseURL    = "https://graph.facebook.com/v19.0"
-	apiVersion = "v19.0"
+	graphURL          = "https://graph.facebook.com"
+	defaultAPIVersion = "v19.0"
 )
 
+// apiVersionPattern matches Graph API versions as accepted by -api-version.
+var apiVersionPattern = regexp.MustCompile(`^v\d+\.\d+$`)
+
+const (
+	accountDetailFields  = "id,name,account_id,currency,timezone_name,business,account_status"
+	accountBillingFields = "funding_source_details,balance,amount_spent,spend_cap,disable_reason"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// defaultInsightsDays is the length of the insights range when -since
+	// and -until are not given: the last full days up to yesterday
+	defaultInsightsDays = 30
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2}_[A-Z]{2}$`)
+
 type Config struct {
-	AccessToken string
-	OutputDir   string
-	Debug       bool
-	MaxPages    int // 0 = unlimited
+	AccessToken       string
+	OutputDir         string
+	Debug             bool
+	MaxPages          int    // 0 = unlimited
+	NameSanitize      string // minimal, slug, or id-only
+	CountOnly         bool   // only request summary=total_count per list edge
+	InsightsSince     string // YYYY-MM-DD, empty = default range
+	InsightsUntil     string // YYYY-MM-DD, empty = default range
+	Incremental       bool   // resume insights from the per-account state file
+	InsightsLevel     string // account, campaign, adset, or ad
+	Breakdowns        string // comma-separated insights breakdowns
+	TimeIncrement     string // e.g. "1" for daily rows, "monthly", or empty
+	ChunkDays         int    // split segmented insights into windows of this many days (0 = off)
+	MaskLevel         string // how tokens appear in logs: full, partial, or none
+	Resources         map[string]bool
+	PreviewFormats    []string
+	SortOutput        bool   // sort records so repeated runs produce identical files
+	OptimizationGoal  string // delivery_estimate optimization_goal, empty = ad set's own
+	EstimateLimit     int    // max ad sets to estimate per account (0 = all)
+	FieldsAll         bool   // request every introspected field for campaigns, ad sets and ads
+	FieldsCachePath   string
+	FieldsCacheTTL    time.Duration
+	ProgressLines     bool // print a DONE line to stdout after each resource
+	ValidateHierarchy bool // report ad sets and ads whose parent wasn't dumped
+	Leadgen           bool // dump lead forms of every page the token manages
+	IncludeLeads      bool // also dump lead submissions (personal data)
+	FileMode          os.FileMode
+	DirMode           os.FileMode
+	SkipExisting      bool   // don't refetch resources that already have a valid dump
+	Locale            string // locale for localized strings, e.g. fr_FR (empty = API default)
+	ParallelPages     int    // workers prefetching offset pages of list edges (0/1 = sequential)
+	AggregateInsights bool   // add summed totals across all insights rows
+	NoRetry           bool   // return the first error instead of retrying
+	TokenContext      bool   // log and dump who the token acts as before discovery
+	Concurrency       int    // accounts processed at the same time
+	InsightsFields    string // comma-separated insights fields, defaults plus -insights-fields-append
+	// LevelInsightsFields maps an insights level to the fields requested
+	// at that level instead of InsightsFields, from -insights-fields
+	LevelInsightsFields map[string]string
+	MaxFileSize         int64 // split a dump's data array into parts above this many bytes (0 = never)
+	// SpendAlertThreshold warns when insights spend moves more than this
+	// many percent from the previous run (0 = off)
+	SpendAlertThreshold float64
+	Trace               bool     // log DNS, connect, TLS and time-to-first-byte timings per request
+	MergeExisting       bool     // merge new insights rows into the previous insights dump
+	MergeKey            string   // comma-separated fields deduplicating merged rows (empty = derived)
+	LogMode             string   // how account log lines are written: stream, buffered or prefixed
+	StripURLParams      []string // query parameters removed from URLs in ad creatives
+	TagRecords          bool     // add a _meta lineage object to every record
+	RunID               string   // identifies this run in the manifest and record tags
+	Timeouts            resourceTimeouts
+	MaxRequests         int      // hard cap on HTTP requests for the whole run (0 = unlimited)
+	InsightsExport      bool     // also download Facebook's CSV export of the insights report
+	EmptyPageTolerance  int      // consecutive empty pages followed before pagination gives up
+	PixelCode           string   // keep, mask or strip the base code in pixels.json
+	TimeoutMultiplier   float64  // growth of the request timeout on each retry
+	Formats             []string // output file formats: json, csv, ndjson
+	IncludeUsers        bool     // dump business and system users of every visible business
+	BigQuery            bool     // also write BigQuery-ready NDJSON plus a schema file
+	OnEmptyInsights     string   // empty, marker or skip when insights return no rows
+	BudgetAsMajor       bool     // write campaign and ad set budgets in major currency units
+	Tree                bool     // also write campaigns, ad sets and ads nested in account_tree.json
+	CompressThreshold   int64    // gzip dump files larger than this many bytes (0 = never)
+	InsightsEnrich      bool     // copy name, status and budgets of the level's objects into insights rows
+	PruneEmpty          bool     // remove account directories no file was written to
+	ExpansionRateFactor float64  // shrink pages of edges whose fields expand nested edges by this factor (1 = off)
+	MaxBytes            int64    // stop requesting once this many response bytes were downloaded (0 = unlimited)
+	MinImpressions      int64    // drop insights rows with fewer impressions (0 = keep all)
+	ConsoleMaxBytes     int64    // truncate each payload printed to the console to this many bytes (0 = unlimited)
+	APIVersion          string   // Graph API version requests go to, e.g. v19.0
+	StrictSchema        string   // off, warn or fail: write numeric insights fields as JSON numbers
+	// RetryCodes are Graph API error codes retried with backoff like
+	// rate limits, from -retry-codes
+	RetryCodes         map[int]bool
+	UnifiedAttribution string // "true" or "false" for use_unified_attribution_setting; empty omits it
+	// SyncWindow restricts each run to objects updated and insights
+	// within this long before its start, see applySyncWindow
+	SyncWindow   time.Duration
+	UpdatedSince time.Time // only fetch objects updated after this; zero = all
+	// Headers are added to every request, from -header
+	Headers http.Header
+	// FieldOverrides replace the fields of a resource, keyed by resource
+	// name, from -campaign-fields, -adset-fields and -ad-fields
+	FieldOverrides map[string]string
 }
 
 type AdAccount struct {
@@ -33,6 +140,32 @@ type AdAccount struct {
 	Currency  string `json:"currency"`
 }
 
+// AdAccountDetails is the full record dumped to ad_account.json. The billing
+// fields need elevated permissions and are left empty when the token
+// lacks them.
+type AdAccountDetails struct {
+	ID            string `json:"id"`
+	AccountID     string `json:"account_id"`
+	Name          string `json:"name"`
+	Currency      string `json:"currency"`
+	TimezoneName  string `json:"timezone_name,omitempty"`
+	AccountStatus int    `json:"account_status"`
+	Business      *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"business,omitempty"`
+	
+	FundingSourceDetails *struct {
+		ID            string `json:"id"`
+		DisplayString string `json:"display_string"`
+		Type          int    `json:"type"`
+	} `json:"funding_source_details,omitempty"`
+	Balance       string `json:"balance,omitempty"`
+	AmountSpent   string `json:"amount_spent,omitempty"`
+	SpendCap      string `json:"spend_cap,omitempty"`
+	DisableReason *int   `json:"disable_reason,omitempty"`
+}
+
 type PaginatedResponse struct {
 	Data   []json.RawMessage `json:"data"`
 	Paging struct {
@@ -57,95 +190,384 @@ type AdAccountsResponse struct {
 type APIClient struct {
 	config     Config
 	httpClient *http.Client
+	fieldCache *fieldCache
+	// pagesFetched counts pages read by fetchPaginated, for progress lines
+	pagesFetched int64
+	// filesWritten counts output files written through writeOutput, for
+	// -prune-empty
+	filesWritten int64
+	httpDump     *httpDumper // nil unless -dump-http is set
+	tokens       TokenProvider
+	requests     *requestBudget
+	downloads    *byteBudget
+	limiter      *rateLimiter
+	checksums    *checksumRecorder // nil unless -checksums is set
+	combined     *combinedCSV      // nil unless -combine-accounts is set
+	compressed   *compressedFiles  // nil unless -compress-threshold is set
+	encryptor    *fileEncryptor    // nil unless -encrypt-key is set
+	logger       *log.Logger       // per-account logger, see startAccountLog
+	// accountID is the ad account requests are attributed to for rate
+	// limiting; empty for requests outside an account
+	accountID string
+	abort     *runAbort
+	deadline  time.Time // end of the run from -max-run-time; zero means none
+	errors    *errorLog // failures of the run, for errors.json
+	currency  string    // currency of the account being processed, if known
+	// levelObjects are the fetched campaigns, ad sets or ads matching
+	// -level, for -insights-enrich
+	levelObjects []json.RawMessage
+	// pageToken is set on copies from withToken, whose token failing does
+	// not abort the run
+	pageToken bool
+	// resource is the resource track is currently fetching, which selects
+	// the request timeout
+	resource string
 }
 
 func NewAPIClient(config Config) *APIClient {
-	return &APIClient{
+	if config.APIVersion == "" {
+		config.APIVersion = defaultAPIVersion
+	}
+	client := &APIClient{
 		config: config,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		// Timeouts are set per request from -timeouts
+		httpClient: &http.Client{},
+		tokens:     StaticTokenProvider{AccessToken: config.AccessToken},
+		limiter:    newRateLimiter(),
+		requests:   &requestBudget{max: int64(config.MaxRequests)},
+		downloads:  &byteBudget{max: config.MaxBytes},
+		abort:      newRunAbort(),
+		errors:     &errorLog{},
+	}
+	if config.FieldsAll {
+		client.fieldCache = loadFieldCache(config.FieldsCachePath, config.APIVersion)
 	}
+	return client
 }
 
-func maskToken(token string) string {
+// baseURL is the Graph API root for the configured version.
+func (c *APIClient) baseURL() string {
+	return graphURL + "/" + c.config.APIVersion
+}
+
+// forAccount returns a copy of the client whose requests are attributed to
+// the given ad account, with its own page counter.
+func (c *APIClient) forAccount(accountID string) *APIClient {
+	clone := *c
+	clone.accountID = accountID
+	clone.pagesFetched = 0
+	clone.filesWritten = 0
+	return &clone
+}
+
+// errUntrustedURL is returned for absolute URLs, such as a tampered
+// paging.next link, that the access token must not be sent to.
+var errUntrustedURL = errors.New("refusing to send the access token to a URL outside the Graph API")
+
+// isTrustedURL reports whether an absolute URL may receive the access
+// token: https on the Graph API host or on the host of insightsExportURL.
+func isTrustedURL(u *url.URL) bool {
+	if u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	for _, trusted := range []string{graphURL, insightsExportURL} {
+		if t, err := url.Parse(trusted); err == nil && strings.EqualFold(u.Host, t.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskedRequestURL returns u with the access token in query replaced by
+// masked. u is a copy and query is not modified.
+func maskedRequestURL(u url.URL, query url.Values, masked string) string {
+	maskedQuery := make(url.Values, len(query))
+	for key, values := range query {
+		maskedQuery[key] = append([]string(nil), values...)
+	}
+	maskedQuery.Set("access_token", masked)
+	u.RawQuery = maskedQuery.Encode()
+	return u.String()
+}
+
+// maskToken hides the access token for logging. "full" replaces it
+// entirely, "partial" keeps the first and last 10 characters, and "none"
+// leaves it untouched for local debugging.
+func maskToken(token string, level string) string {
+	switch level {
+	case "none":
+		return token
+	case "full":
+		return "***"
+	}
 	if len(token) <= 20 {
 		return "***"
 	}
 	return token[:10] + "..." + token[len(token)-10:]
 }
 
+// sanitizeName makes an account name safe to use as a directory name.
+// "minimal" only replaces path separators and colons, "slug" lowercases the
+// name and reduces it to ASCII letters, digits and hyphens, and "id-only"
+// drops the name entirely.
+func sanitizeName(name, mode string) string {
+	switch mode {
+	case "id-only":
+		return ""
+	case "slug":
+		var b strings.Builder
+		pendingHyphen := false
+		for _, r := range strings.ToLower(name) {
+			switch {
+			case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+				if pendingHyphen && b.Len() > 0 {
+					b.WriteByte('-')
+				}
+				pendingHyphen = false
+				b.WriteRune(r)
+			case unicode.IsSpace(r) || r == '-' || r == '_':
+				pendingHyphen = true
+			}
+		}
+		return b.String()
+	default:
+		return strings.Map(func(r rune) rune {
+			if r == '/' || r == '\\' || r == ':' {
+				return '_'
+			}
+			return r
+		}, name)
+	}
+}
+
+// accountDirName returns <account_id>_<name>, or just the account ID when
+// the name is empty or blank after sanitizing.
+func accountDirName(account AdAccount, mode string) string {
+	safeName := strings.TrimSpace(sanitizeName(strings.TrimSpace(account.Name), mode))
+	if safeName == "" {
+		return account.AccountID
+	}
+	return fmt.Sprintf("%s_%s", account.AccountID, safeName)
+}
+
+// parseFileMode parses an octal permission string such as "0640".
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an octal mode", value)
+	}
+	if mode > 0777 {
+		return 0, fmt.Errorf("%q has bits outside 0777", value)
+	}
+	return os.FileMode(mode), nil
+}
+
 func (c *APIClient) makeRequest(endpoint string) ([]byte, error) {
-	return c.makeRequestWithRetry(endpoint, 0)
+	return c.makeRequestWithRetry(c.accountID, endpoint, nil, 0)
 }
 
-func (c *APIClient) makeRequestWithRetry(endpoint string, retryCount int) ([]byte, error) {
-	// Properly construct URL with encoded access token
-	baseEndpoint := fmt.Sprintf("%s/%s", baseURL, endpoint)
+// makePostRequest sends form as a POST request, for the few Graph API calls
+// that create something, such as async report runs.
+func (c *APIClient) makePostRequest(endpoint string, form url.Values) ([]byte, error) {
+	return c.makeRequestWithRetry(c.accountID, endpoint, form, 0)
+}
+
+// makeRequestWithRetry performs a GET request, or a POST of form when form
+// is not nil. Throttling decisions from the usage headers and rate limit
+// responses only hold back requests for accountID.
+func (c *APIClient) makeRequestWithRetry(accountID, endpoint string, form url.Values, retryCount int) ([]byte, error) {
+	if c.abort.aborted() {
+		return nil, errTokenInvalidated
+	}
+	if err := c.checkDeadline(c.limiter.remaining(accountID)); err != nil {
+		return nil, err
+	}
+	if err := c.downloads.check(); err != nil {
+		return nil, err
+	}
+	if err := c.requests.take(); err != nil {
+		return nil, err
+	}
+	c.limiter.wait(accountID)
+	
+	// Properly construct URL with encoded access token. Absolute URLs
+	// (such as paging.next links) are used as-is, but only if they point
+	// where the token may go.
+	baseEndpoint := endpoint
+	absolute := strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://")
+	if !absolute {
+		baseEndpoint = fmt.Sprintf("%s/%s", c.baseURL(), endpoint)
+	}
 	parsedURL, err := url.Parse(baseEndpoint)
 	if err != nil {
 		return nil, fmt.Errorf("parsing URL: %w", err)
 	}
+	if absolute && !isTrustedURL(parsedURL) {
+		return nil, fmt.Errorf("%w: %s://%s%s", errUntrustedURL, parsedURL.Scheme, parsedURL.Host, parsedURL.Path)
+	}
 	
-	// Add access_token as a query parameter
+	timeout := c.config.Timeouts.forAttempt(c.resource, c.config.TimeoutMultiplier, retryCount)
+	ctx, cancel := context.WithTimeout(c.abort.ctx, timeout)
+	defer cancel()
+	if !c.deadline.IsZero() {
+		var cancelRun context.CancelFunc
+		ctx, cancelRun = context.WithDeadline(ctx, c.deadline)
+		defer cancelRun()
+	}
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting access token: %w", err)
+	}
+	
+	// Add access_token as a query parameter, replacing any token already
+	// embedded in the URL
 	query := parsedURL.Query()
-	query.Set("access_token", c.config.AccessToken)
+	query.Set("access_token", token)
+	if c.config.Locale != "" {
+		query.Set("locale", c.config.Locale)
+	}
 	parsedURL.RawQuery = query.Encode()
 	
 	finalURL := parsedURL.String()
 	
+	// URL with masked token, used for debug output and error messages. It
+	// is built from a copy so the real query can't pick up the mask, nor
+	// the masked URL the real token, whatever the order of these steps.
+	maskedURL := maskedRequestURL(*parsedURL, query, maskToken(token, c.config.MaskLevel))
+	
 	if c.config.Debug {
-		// Show URL with masked token
-		maskedQuery := query
-		maskedQuery.Set("access_token", maskToken(c.config.AccessToken))
-		parsedURL.RawQuery = maskedQuery.Encode()
-		log.Printf("[DEBUG] Request URL: %s", parsedURL.String())
+		c.logf("[DEBUG] Request URL: %s", maskedURL)
 		if retryCount > 0 {
-			log.Printf("[DEBUG] Retry attempt: %d", retryCount)
+			c.logf("[DEBUG] Retry attempt: %d", retryCount)
 		}
 	}
 	
-	resp, err := c.httpClient.Get(finalURL)
+	method, reqBody := http.MethodGet, io.Reader(nil)
+	if form != nil {
+		method, reqBody = http.MethodPost, strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, finalURL, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	// Setting Accept-Encoding ourselves disables the transport's transparent
+	// decompression, so gzip bodies are decoded in readBody
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", userAgent())
+	for name, values := range c.config.Headers {
+		req.Header[name] = values
+	}
+	var trace *requestTrace
+	if c.config.Trace {
+		trace = newRequestTrace()
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	}
+	
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		if c.abort.aborted() {
+			return nil, errTokenInvalidated
+		}
+		// Transport errors embed the full request URL, token included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = maskedURL
+		}
+		if c.httpDump != nil {
+			c.httpDump.record(req.Method, maskedURL, req.Header, nil, nil, err)
+		}
+		c.logf("Request error [%s]: %v", errorClassNetwork, err)
+		// A slow response gets another attempt with a longer timeout
+		if errors.Is(err, context.DeadlineExceeded) && c.checkDeadline(0) != nil {
+			return nil, fmt.Errorf("request failed: %w", errRunDeadline)
+		}
+		// POSTs are not sent again: the API may have acted on one that
+		// timed out, such as a report run or batch that was started
+		if errors.Is(err, context.DeadlineExceeded) && form == nil && !c.config.NoRetry && retryCount < 3 {
+			c.logf("Request timed out after %v, retrying with %v", timeout,
+				c.config.Timeouts.forAttempt(c.resource, c.config.TimeoutMultiplier, retryCount+1))
+			return c.makeRequestWithRetry(accountID, endpoint, form, retryCount+1)
+		}
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 	
 	if c.config.Debug {
-		log.Printf("[DEBUG] Response status: %d %s", resp.StatusCode, resp.Status)
+		c.logf("[DEBUG] Response status: %d %s", resp.StatusCode, resp.Status)
 	}
 	
-	body, err := io.ReadAll(resp.Body)
+	c.limiter.observe(accountID, resp.Header)
+	
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("reading response: %w", err)
 	}
+	if trace != nil {
+		c.logTrace(trace, maskedURL)
+	}
+	if c.httpDump != nil {
+		c.httpDump.record(req.Method, maskedURL, req.Header, resp, body, nil)
+	}
 	
 	// Handle rate limiting with exponential backoff
 	if resp.StatusCode == 429 || resp.StatusCode == 17 {
+		c.logf("Request error [%s]: status %d", errorClassRateLimit, resp.StatusCode)
+		if c.config.NoRetry {
+			return nil, fmt.Errorf("%w (status %d), not retrying because of -no-retry", errRateLimited, resp.StatusCode)
+		}
 		if retryCount < 3 {
 			waitTime := time.Duration(1<<uint(retryCount)) * time.Second
-			log.Printf("Rate limit hit, waiting %v before retry...", waitTime)
-			time.Sleep(waitTime)
-			return c.makeRequestWithRetry(endpoint, retryCount+1)
+			if err := c.checkDeadline(waitTime); err != nil {
+				return nil, fmt.Errorf("%w, not retrying: %w", errRateLimited, err)
+			}
+			c.logf("Rate limit hit for account %s, waiting %v before retry...", accountLabel(accountID), waitTime)
+			c.limiter.pause(accountID, waitTime)
+			return c.makeRequestWithRetry(accountID, endpoint, form, retryCount+1)
 		}
-		return nil, fmt.Errorf("rate limit exceeded after %d retries", retryCount)
+		return nil, fmt.Errorf("%w after %d retries", errRateLimited, retryCount)
 	}
 	
 	if resp.StatusCode != http.StatusOK {
 		// Try to parse error for better messaging
 		var errorResponse struct {
 			Error struct {
-				Message string `json:"message"`
-				Type    string `json:"type"`
-				Code    int    `json:"code"`
+				Message   string `json:"message"`
+				Type      string `json:"type"`
+				Code      int    `json:"code"`
+				Subcode   int    `json:"error_subcode"`
+				FBTraceID string `json:"fbtrace_id"`
 			} `json:"error"`
 		}
-		if err := json.Unmarshal(body, &errorResponse); err == nil {
-			return body, fmt.Errorf("API error (status %d): %s [Code: %d, Type: %s]",
-				resp.StatusCode,
-				errorResponse.Error.Message,
-				errorResponse.Error.Code,
-				errorResponse.Error.Type)
+		parseErr := json.Unmarshal(body, &errorResponse)
+		c.logf("Request error [%s]: status %d, code %d", classifyError(resp.StatusCode, errorResponse.Error.Code),
+			resp.StatusCode, errorResponse.Error.Code)
+		
+		// Operators can mark further error codes as worth another attempt
+		if parseErr == nil && c.config.RetryCodes[errorResponse.Error.Code] && !c.config.NoRetry && retryCount < 3 {
+			waitTime := time.Duration(1<<uint(retryCount)) * time.Second
+			if err := c.checkDeadline(waitTime); err == nil {
+				c.logf("Code %d is in -retry-codes, waiting %v before retry...", errorResponse.Error.Code, waitTime)
+				c.limiter.pause(accountID, waitTime)
+				return c.makeRequestWithRetry(accountID, endpoint, form, retryCount+1)
+			}
+		}
+		
+		if parseErr == nil {
+			apiErr := &apiError{
+				Status:    resp.StatusCode,
+				Message:   errorResponse.Error.Message,
+				Code:      errorResponse.Error.Code,
+				Type:      errorResponse.Error.Type,
+				Subcode:   errorResponse.Error.Subcode,
+				FBTraceID: errorResponse.Error.FBTraceID,
+			}
+			if isTokenInvalidError(apiErr) && !c.pageToken {
+				c.abort.trip(apiErr)
+			}
+			return body, apiErr
 		}
 		return body, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 	}
@@ -153,40 +575,160 @@ func (c *APIClient) makeRequestWithRetry(endpoint string, retryCount int) ([]byt
 	return body, nil
 }
 
+const (
+	errorClassRateLimit = "rate-limit"
+	errorClassServer    = "server"
+	errorClassClient    = "client"
+	errorClassNetwork   = "network"
+)
+
+// errRateLimited is returned when a request stays rate limited.
+var errRateLimited = errors.New("rate limit exceeded")
+
+// apiError is a Graph API error response.
+type apiError struct {
+	Status    int
+	Message   string
+	Code      int
+	Type      string
+	Subcode   int
+	FBTraceID string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s [Code: %d, Type: %s]", e.Status, e.Message, e.Code, e.Type)
+}
+
+// isPermissionError reports whether err is a Graph API permission error
+// (code 10 or 200-299), as returned when the token lacks a scope or role.
+func isPermissionError(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == 10 || (apiErr.Code >= 200 && apiErr.Code <= 299)
+}
+
+// isTransientError reports whether a failed request is worth repeating
+// later: network failures, server errors and rate limits are, while client
+// errors such as an invalid token are not.
+func isTransientError(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return classifyError(apiErr.Status, apiErr.Code) != errorClassClient
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	return errors.Is(err, errRateLimited)
+}
+
+// parseRetryCodes parses the comma-separated -retry-codes value.
+func parseRetryCodes(value string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, item := range splitList(value) {
+		code, err := strconv.Atoi(item)
+		if err != nil || code <= 0 {
+			return nil, fmt.Errorf("%q is not a Graph API error code", item)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// classifyError buckets a failed response by HTTP status and Graph API
+// error code. Facebook usually reports throttling as a 400 with one of the
+// rate-limit codes rather than a 429.
+func classifyError(status int, code int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return errorClassRateLimit
+	case code == 4 || code == 17 || code == 32 || code == 613 || (code >= 80000 && code <= 80014):
+		return errorClassRateLimit
+	case status >= 500:
+		return errorClassServer
+	default:
+		return errorClassClient
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// readBody reads the response body, decompressing it when the server
+// answered with Content-Encoding: gzip.
+func (c *APIClient) readBody(resp *http.Response) ([]byte, error) {
+	wire := &countingReader{r: resp.Body}
+	var reader io.Reader = wire
+	
+	gzipped := strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+	if gzipped {
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	
+	body, err := io.ReadAll(reader)
+	c.downloads.add(wire.n)
+	if err != nil {
+		return nil, err
+	}
+	
+	if c.config.Debug {
+		if gzipped {
+			c.logf("[DEBUG] Response size: %d bytes compressed, %d bytes uncompressed", wire.n, len(body))
+		} else {
+			c.logf("[DEBUG] Response size: %d bytes (uncompressed)", len(body))
+		}
+	}
+	return body, nil
+}
+
 func (c *APIClient) fetchPaginated(baseEndpoint string, resourceName string) ([]json.RawMessage, error) {
 	var allData []json.RawMessage
 	pageCount := 0
-	cursor := ""
+	emptyPages := 0
+	lastAfter := ""
+	endpoint := baseEndpoint
 	
 	for {
 		pageCount++
 		
 		// Check if we've hit the max pages limit
 		if c.config.MaxPages > 0 && pageCount > c.config.MaxPages {
-			log.Printf("Reached max pages limit (%d) for %s", c.config.MaxPages, resourceName)
+			c.logf("Reached max pages limit (%d) for %s", c.config.MaxPages, resourceName)
 			break
 		}
 		
-		// Build endpoint with cursor if present
-		endpoint := baseEndpoint
-		if cursor != "" {
-			separator := "&"
-			if !strings.Contains(endpoint, "?") {
-				separator = "?"
-			}
-			endpoint = fmt.Sprintf("%s%safter=%s", endpoint, separator, cursor)
-		}
-		
 		if pageCount > 1 {
-			log.Printf("  Fetching page %d for %s...", pageCount, resourceName)
+			c.logf("  Fetching page %d for %s...", pageCount, resourceName)
 		} else {
-			log.Printf("Requesting: %s", endpoint)
+			c.logf("Requesting: %s", endpoint)
 		}
 		
 		data, err := c.makeRequest(endpoint)
+		if isRunLimit(err) && len(allData) > 0 {
+			// Keep what was collected so it still gets written
+			c.logf("Stopping %s after %d items: %v", resourceName, len(allData), err)
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
+		atomic.AddInt64(&c.pagesFetched, 1)
 		
 		var response PaginatedResponse
 		if err := json.Unmarshal(data, &response); err != nil {
@@ -196,47 +738,186 @@ func (c *APIClient) fetchPaginated(baseEndpoint string, resourceName string) ([]
 		// Append data from this page
 		allData = append(allData, response.Data...)
 		
-		// Check if there's a next page
-		if response.Paging.Cursors.After == "" {
+		// Check if there's a next page. paging.next is followed as a full
+		// URL because it may carry a different API version than
+		// c.baseURL(); makeRequest re-applies our token to it, and refuses
+		// links that leave the Graph API.
+		next := response.Paging.Next
+		after := response.Paging.Cursors.After
+		if len(response.Data) == 0 {
+			emptyPages++
+			// While results settle, an empty page may come with an after
+			// cursor but no next link; the cursor is followed rather than
+			// taking the page as the end
+			if next == "" && after != "" && after != lastAfter {
+				if next, err = withAfterCursor(endpoint, after); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			emptyPages = 0
+		}
+		lastAfter = after
+		
+		if next == "" {
 			if pageCount > 1 {
-				log.Printf("  Completed: fetched %d items across %d pages for %s", len(allData), pageCount, resourceName)
+				c.logf("  Completed: fetched %d items across %d pages for %s", len(allData), pageCount, resourceName)
 			}
 			break
 		}
+		if emptyPages > c.config.EmptyPageTolerance {
+			c.logf("Warning: stopping %s after %d consecutive empty pages (-empty-page-tolerance %d)",
+				resourceName, emptyPages, c.config.EmptyPageTolerance)
+			break
+		}
 		
-		cursor = response.Paging.Cursors.After
+		if _, err := url.Parse(next); err != nil {
+			return nil, fmt.Errorf("parsing paging.next URL: %w", err)
+		}
+		endpoint = next
 	}
 	
 	return allData, nil
 }
 
+// withAfterCursor returns endpoint with its after cursor replaced.
+func withAfterCursor(endpoint, after string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("parsing page URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("after", after)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// fetchCount asks a list edge for its size only, using limit=0 and
+// summary=total_count so that no records are transferred. The edge may
+// carry a query, such as the filtering of -sync-window, to count only the
+// matching records.
+func (c *APIClient) fetchCount(edge string, resourceName string) (int, error) {
+	separator := "?"
+	if strings.Contains(edge, "?") {
+		separator = "&"
+	}
+	endpoint := fmt.Sprintf("%s%slimit=0&summary=total_count", edge, separator)
+	c.logf("Requesting: %s (count only)", endpoint)
+	data, err := c.makeRequest(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	
+	var response struct {
+		Summary struct {
+			TotalCount int `json:"total_count"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, fmt.Errorf("parsing %s count response: %w", resourceName, err)
+	}
+	
+	c.logf("  %s: %d", resourceName, response.Summary.TotalCount)
+	return response.Summary.TotalCount, nil
+}
+
 func (c *APIClient) dumpResponse(name string, data []byte, accountDir string) error {
 	// Pretty print to console
 	var prettyJSON interface{}
 	if err := json.Unmarshal(data, &prettyJSON); err != nil {
-		log.Printf("Warning: Invalid JSON from %s", name)
-		fmt.Printf("\n=== %s (RAW) ===\n%s\n\n", name, string(data))
+		c.logf("Warning: Invalid JSON from %s", name)
+		fmt.Printf("\n=== %s (RAW) ===\n%s\n\n", name, c.consoleText(data))
 		return nil
 	}
 	
 	formatted, _ := json.MarshalIndent(prettyJSON, "", "  ")
-	fmt.Printf("\n=== %s ===\n%s\n\n", name, string(formatted))
+	fmt.Printf("\n=== %s ===\n%s\n\n", name, c.consoleText(formatted))
 	
 	// Save to file if output directory specified
 	if c.config.OutputDir != "" && accountDir != "" {
-		filename := fmt.Sprintf("%s/%s_%d.json", accountDir, name, time.Now().Unix())
-		if err := os.WriteFile(filename, formatted, 0644); err != nil {
-			return fmt.Errorf("writing file: %w", err)
+		base := fmt.Sprintf("%s/%s_%d", accountDir, name, time.Now().Unix())
+		for _, format := range c.config.outputFormats() {
+			var err error
+			switch format {
+			case formatJSON:
+				err = c.writeJSONDump(base, formatted)
+			case formatCSV:
+				err = c.writeCSVDump(base, formatted)
+			case formatNDJSON:
+				err = c.writeNDJSONDump(base, formatted)
+			case formatParquet:
+				err = c.writeParquetDump(base, formatted)
+			}
+			if err != nil {
+				return fmt.Errorf("writing file: %w", err)
+			}
+		}
+		if c.config.BigQuery {
+			if err := c.writeBigQueryDump(base, formatted); err != nil {
+				return fmt.Errorf("writing BigQuery files: %w", err)
+			}
+		}
+		if err := c.combineDump(name, formatted); err != nil {
+			return fmt.Errorf("combining %s across accounts: %w", name, err)
 		}
-		log.Printf("Saved to: %s", filename)
 	}
 	
 	return nil
 }
 
+// consoleText cuts data to -console-max-bytes for printing. The files
+// written by dumpResponse always get the full data.
+func (c *APIClient) consoleText(data []byte) string {
+	max := c.config.ConsoleMaxBytes
+	if max <= 0 || int64(len(data)) <= max {
+		return string(data)
+	}
+	cut := int(max)
+	for cut > 0 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	return string(data[:cut]) + "\n... (truncated, full data in file)"
+}
+
+// writeJSONDump writes <base>.json, split into parts when it is larger
+// than -max-file-size.
+func (c *APIClient) writeJSONDump(base string, formatted []byte) error {
+	filename := base + ".json"
+	if c.config.MaxFileSize > 0 && int64(len(formatted)) > c.config.MaxFileSize {
+		split, err := c.writeParts(base, formatted)
+		if err != nil {
+			return err
+		}
+		if split {
+			c.logf("Saved to: %s", filename)
+			return nil
+		}
+	}
+	filename, err := c.writeDumpOutput(filename, formatted)
+	if err != nil {
+		return err
+	}
+	c.logf("Saved to: %s", filename)
+	return nil
+}
+
+const (
+	discoveryFields     = "id,name,account_id,currency,timezone_name,account_status"
+	discoveryCoreFields = "id,account_id,name"
+)
+
 func (c *APIClient) fetchAdAccounts() ([]AdAccount, error) {
-	endpoint := "me/adaccounts?fields=id,name,account_id,currency,timezone_name,account_status"
-	data, err := c.makeRequest(endpoint)
+	data, err := c.makeRequest("me/adaccounts?fields=" + discoveryFields)
+	if err != nil && !isTransientError(err) && !isTokenInvalidError(err) {
+		// A token may lack access to single fields; the account list is
+		// what matters, so retry with the fields every token can read
+		dropped := splitList(discoveryFields)
+		for _, field := range splitList(discoveryCoreFields) {
+			dropped = removeField(dropped, field)
+		}
+		c.logf("Account discovery failed (%v), retrying without fields %s", err, strings.Join(dropped, ","))
+		data, err = c.makeRequest("me/adaccounts?fields=" + discoveryCoreFields)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -253,123 +934,287 @@ func (c *APIClient) fetchAdAccounts() ([]AdAccount, error) {
 }
 
 func (c *APIClient) fetchAdAccount(accountID string, accountDir string) error {
-	endpoint := fmt.Sprintf("%s?fields=id,name,account_id,currency,timezone_name,business,account_status", accountID)
-	log.Printf("Requesting: %s (ad account details)", accountID)
+	endpoint := fmt.Sprintf("%s?fields=%s,%s", accountID, accountDetailFields, accountBillingFields)
+	c.logf("Requesting: %s (ad account details)", accountID)
 	data, err := c.makeRequest(endpoint)
 	if err != nil {
-		return err
+		// Billing fields require finance permissions on the account, so
+		// fall back to the core details rather than losing them entirely.
+		// Other failures are returned as they are.
+		if !isPermissionError(err) {
+			return err
+		}
+		c.logf("Billing details unavailable (%v), retrying with core fields only", err)
+		endpoint = fmt.Sprintf("%s?fields=%s", accountID, accountDetailFields)
+		data, err = c.makeRequest(endpoint)
+		if err != nil {
+			return err
+		}
+	}
+	
+	var details AdAccountDetails
+	if err := json.Unmarshal(data, &details); err != nil {
+		return fmt.Errorf("parsing ad account details: %w", err)
 	}
-	return c.dumpResponse("ad_account", data, accountDir)
+	
+	detailsJSON, _ := json.Marshal(details)
+	return c.dumpResponse("ad_account", detailsJSON, accountDir)
 }
 
-func (c *APIClient) fetchCampaigns(accountID string, accountDir string) error {
-	endpoint := fmt.Sprintf("%s/campaigns?fields=id,name,status,objective,created_time,updated_time&limit=100", accountID)
-	allData, err := c.fetchPaginated(endpoint, "campaigns")
-	if err != nil {
-		return err
+func (c *APIClient) fetchInsights(accountID string, accountDir string) (int, error) {
+	defaultSince, defaultUntil := defaultInsightsRange(time.Now())
+	until := c.config.InsightsUntil
+	if until == "" {
+		until = defaultUntil
 	}
 	
-	// Construct aggregated response
-	aggregatedResponse := map[string]interface{}{
-		"data": allData,
-		"summary": map[string]interface{}{
-			"total_count": len(allData),
-		},
+	// An explicit -since always wins over the incremental state
+	since := c.config.InsightsSince
+	if since == "" {
+		since = defaultSince
+		if c.config.Incremental && accountDir != "" {
+			state, err := loadInsightsState(accountDir)
+			if err != nil {
+				return 0, err
+			}
+			if state.LastUntil != "" {
+				if since, err = nextDay(state.LastUntil); err != nil {
+					return 0, fmt.Errorf("insights state: %w", err)
+				}
+				c.logf("Resuming insights after %s", state.LastUntil)
+			}
+		}
 	}
 	
-	responseJSON, _ := json.Marshal(aggregatedResponse)
-	return c.dumpResponse("campaigns", responseJSON, accountDir)
-}
-
-func (c *APIClient) fetchAdSets(accountID string, accountDir string) error {
-	endpoint := fmt.Sprintf("%s/adsets?fields=id,name,status,campaign_id,daily_budget,lifetime_budget,created_time&limit=100", accountID)
-	allData, err := c.fetchPaginated(endpoint, "adsets")
+	if since > until {
+		c.logf("Insights already up to date through %s, skipping", until)
+		return 0, nil
+	}
+	
+	// Long ranges of segmented insights run into deep-pagination limits,
+	// so they are requested window by window and merged
+	chunkDays := 0
+	if c.segmentsInsights() {
+		chunkDays = c.config.ChunkDays
+	}
+	windows, err := splitDateRange(since, until, chunkDays)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if len(windows) > 1 {
+		c.logf("Splitting insights %s to %s into %d windows of up to %d days", since, until, len(windows), chunkDays)
 	}
 	
-	aggregatedResponse := map[string]interface{}{
-		"data": allData,
-		"summary": map[string]interface{}{
-			"total_count": len(allData),
-		},
+	var allData []json.RawMessage
+	// Fields the account doesn't support are dropped as the API reports
+	// them and stay dropped for the remaining windows
+	fields := splitList(c.config.levelInsightsFields())
+	if c.config.MinImpressions > 0 && !containsField(c.config.levelInsightsFields(), "impressions") {
+		fields = append(fields, "impressions")
+	}
+	// Rows are matched to their objects by <level>_id, which the default
+	// fields don't include
+	if idField := c.config.InsightsLevel + "_id"; c.config.InsightsEnrich && c.levelObjects != nil && !containsField(c.config.levelInsightsFields(), idField) {
+		fields = append(fields, idField)
+	}
+	var dropped []string
+	for _, window := range windows {
+		for {
+			endpoint := fmt.Sprintf("%s/insights?fields=%s&level=%s&time_range=%s&limit=100", accountID, strings.Join(fields, ","), c.config.InsightsLevel, url.QueryEscape(window.timeRange()))
+			if c.config.Breakdowns != "" {
+				endpoint += "&breakdowns=" + c.config.Breakdowns
+			}
+			if c.config.TimeIncrement != "" {
+				endpoint += "&time_increment=" + c.config.TimeIncrement
+			}
+			if c.config.UnifiedAttribution != "" {
+				endpoint += "&use_unified_attribution_setting=" + c.config.UnifiedAttribution
+			}
+			
+			c.logf("Requesting: insights (%s to %s)", window.Since, window.Until)
+			data, err := c.fetchPaginated(endpoint, "insights")
+			if err != nil {
+				field := unavailableInsightsField(err, fields)
+				if field == "" || len(fields) == 1 {
+					return 0, err
+				}
+				c.logf("Insights field %s is not available for %s, retrying without it", field, accountID)
+				fields = removeField(fields, field)
+				dropped = append(dropped, field)
+				continue
+			}
+			allData = append(allData, data...)
+			break
+		}
+	}
+	if len(dropped) > 0 {
+		c.logf("Dropped insights fields for %s: %s", accountID, strings.Join(dropped, ", "))
 	}
+	if c.config.StrictSchema != strictSchemaOff {
+		var problems []string
+		allData, problems, err = applyStrictSchema(allData, c.config.StrictSchema)
+		if err != nil {
+			return 0, fmt.Errorf("validating insights: %w", err)
+		}
+		for _, problem := range problems {
+			c.logf("Insights of %s: unparseable numbers written as null in %s", accountID, problem)
+		}
+	}
+	if c.config.MinImpressions > 0 {
+		var filtered int
+		allData, filtered, err = filterMinImpressions(allData, c.config.MinImpressions)
+		if err != nil {
+			return 0, fmt.Errorf("filtering insights: %w", err)
+		}
+		c.logf("Filtered %d insights rows of %s below %d impressions", filtered, accountID, c.config.MinImpressions)
+	}
+	if c.config.InsightsEnrich && c.levelObjects != nil {
+		var missing int
+		allData, missing = enrichInsights(allData, c.levelObjects, c.config.InsightsLevel)
+		if missing > 0 {
+			c.logf("%d insights rows of %s have no matching %s, left unenriched", missing, accountID, c.config.InsightsLevel)
+		}
+	}
+	allData = c.tagRecords(allData)
 	
-	responseJSON, _ := json.Marshal(aggregatedResponse)
-	return c.dumpResponse("adsets", responseJSON, accountDir)
-}
-
-func (c *APIClient) fetchAds(accountID string, accountDir string) error {
-	endpoint := fmt.Sprintf("%s/ads?fields=id,name,status,adset_id,creative,created_time&limit=100", accountID)
-	allData, err := c.fetchPaginated(endpoint, "ads")
-	if err != nil {
-		return err
+	schema := insightsSchema(fields, c.config.Breakdowns)
+	summarySince, summaryUntil := since, until
+	if c.config.MergeExisting && accountDir != "" {
+		allData, summarySince, summaryUntil = c.mergeExistingInsights(accountDir, allData, schema, since, until)
+	}
+	if c.config.SortOutput {
+		sortRecords(allData, "date_start", "campaign_id", "adset_id", "ad_id")
 	}
 	
 	aggregatedResponse := map[string]interface{}{
 		"data": allData,
 		"summary": map[string]interface{}{
 			"total_count": len(allData),
+			"since":       summarySince,
+			"until":       summaryUntil,
+			"fields":      schema,
 		},
 	}
+	if c.config.AggregateInsights {
+		totals, err := insightsTotals(allData)
+		if err != nil {
+			return 0, fmt.Errorf("aggregating insights: %w", err)
+		}
+		aggregatedResponse["totals"] = totals
+	}
 	
-	responseJSON, _ := json.Marshal(aggregatedResponse)
-	return c.dumpResponse("ads", responseJSON, accountDir)
-}
-
-func (c *APIClient) fetchInsights(accountID string, accountDir string) error {
-	endpoint := fmt.Sprintf("%s/insights?fields=impressions,clicks,spend,ctr,cpc,date_start,date_stop&level=account&time_range={'since':'2026-01-01','until':'2026-02-03'}", accountID)
-	log.Printf("Requesting: insights")
-	data, err := c.makeRequest(endpoint)
-	if err != nil {
-		return err
+	// A successful query without rows means no delivery in the range; the
+	// marker tells it apart from a failed query downstream
+	if len(allData) == 0 {
+		switch c.config.OnEmptyInsights {
+		case emptyInsightsMarker:
+			aggregatedResponse["no_data"] = true
+		case emptyInsightsSkip:
+			c.logf("No insights rows for %s to %s, not writing a file", summarySince, summaryUntil)
+		}
 	}
-	return c.dumpResponse("insights", data, accountDir)
+	
+	if len(allData) > 0 || c.config.OnEmptyInsights != emptyInsightsSkip {
+		responseJSON, _ := json.Marshal(aggregatedResponse)
+		if err := c.dumpResponse("insights", responseJSON, accountDir); err != nil {
+			return 0, err
+		}
+	}
+	
+	// Only advance the state once the dump is on disk so a failed run is
+	// retried from the same day next time
+	if c.config.Incremental && accountDir != "" {
+		if err := saveInsightsState(accountDir, insightsState{LastUntil: until}, c.config.FileMode); err != nil {
+			return len(allData), err
+		}
+	}
+	return len(allData), nil
 }
 
-func (c *APIClient) processAccount(account AdAccount) error {
-	log.Printf("\n========================================")
-	log.Printf("Processing Account: %s (%s)", account.Name, account.AccountID)
-	log.Printf("========================================\n")
+func (c *APIClient) processAccount(account AdAccount) (AccountManifest, error) {
+	c.logf("\n========================================")
+	c.logf("Processing Account: %s (%s)", account.Name, account.AccountID)
+	c.logf("========================================\n")
+	
+	entry := AccountManifest{
+		ID:        account.ID,
+		AccountID: account.AccountID,
+		Name:      account.Name,
+	}
+	c.currency = account.Currency
+	
+	if c.config.CountOnly {
+		// Only the list edges support summary=total_count, and nothing is
+		// written per account so no directory is needed
+		for _, r := range knownResources {
+			if !r.Countable || !c.wants(r.Name) {
+				continue
+			}
+			c.track(&entry, r.Name, r.Name+" count", func() (int, error) {
+				return c.fetchCount(account.ID+"/"+r.Edge, r.Name)
+			})
+		}
+		return entry, nil
+	}
 	
 	// Create account-specific directory if output is enabled
 	var accountDir string
 	if c.config.OutputDir != "" {
-		// Sanitize account name for directory
-		safeName := strings.Map(func(r rune) rune {
-			if r == '/' || r == '\\' || r == ':' {
-				return '_'
-			}
-			return r
-		}, account.Name)
-		accountDir = filepath.Join(c.config.OutputDir, fmt.Sprintf("%s_%s", account.AccountID, safeName))
-		if err := os.MkdirAll(accountDir, 0755); err != nil {
-			return fmt.Errorf("creating account directory: %w", err)
+		accountDir = filepath.Join(c.config.OutputDir, accountDirName(account, c.config.NameSanitize))
+		if err := os.MkdirAll(accountDir, c.config.DirMode); err != nil {
+			return entry, fmt.Errorf("creating account directory: %w", err)
 		}
+		entry.Directory = accountDir
 	}
 	
 	// Fetch all resources for this account
-	if err := c.fetchAdAccount(account.ID, accountDir); err != nil {
-		log.Printf("Error fetching ad account details: %v", err)
-	}
+	c.fetchResources(&accountRun{
+		entry:      &entry,
+		accountID:  account.ID,
+		accountDir: accountDir,
+		records:    make(map[string][]json.RawMessage),
+	})
 	
-	if err := c.fetchCampaigns(account.ID, accountDir); err != nil {
-		log.Printf("Error fetching campaigns: %v", err)
+	if c.config.PruneEmpty && accountDir != "" && atomic.LoadInt64(&c.filesWritten) == 0 {
+		c.pruneAccountDir(&entry, accountDir)
 	}
-	
-	if err := c.fetchAdSets(account.ID, accountDir); err != nil {
-		log.Printf("Error fetching ad sets: %v", err)
+	return entry, nil
+}
+
+// track runs a single resource fetch, logs a failure, and records the
+// outcome in the account's manifest entry. With -progress-lines it also
+// prints a one-line completion summary to stdout. With -skip-existing a
+// resource that already has a valid dump is not fetched again.
+func (c *APIClient) track(entry *AccountManifest, resource, label string, fetch func() (int, error)) {
+	if c.config.SkipExisting && entry.Directory != "" {
+		if path, count, ok := existingDump(entry.Directory, resource, c.dumpKey()); ok {
+			c.logf("Skipping %s: already dumped to %s", label, path)
+			entry.skip(resource, count)
+			return
+		}
 	}
 	
-	if err := c.fetchAds(account.ID, accountDir); err != nil {
-		log.Printf("Error fetching ads: %v", err)
-	}
+	c.resource = resource
+	defer func() { c.resource = "" }()
+	
+	started := time.Now()
+	pagesBefore := atomic.LoadInt64(&c.pagesFetched)
 	
-	if err := c.fetchInsights(account.ID, accountDir); err != nil {
-		log.Printf("Error fetching insights: %v", err)
+	count, err := fetch()
+	if err != nil {
+		c.logf("Error fetching %s: %v", label, err)
+		c.errors.add(entry.ID, resource, err)
 	}
+	entry.record(resource, count, err)
 	
-	return nil
+	if c.config.ProgressLines {
+		status := "ok"
+		if err != nil {
+			status = "failed"
+		}
+		fmt.Printf("DONE account=%s resource=%s count=%d pages=%d dur=%.1fs status=%s\n",
+			entry.ID, resource, count, atomic.LoadInt64(&c.pagesFetched)-pagesBefore, time.Since(started).Seconds(), status)
+	}
 }
 
 func main() {
@@ -377,74 +1222,745 @@ func main() {
 	outputDir := flag.String("output", "", "Output directory for JSON files (optional)")
 	debug := flag.Bool("debug", false, "Enable debug output")
 	maxPages := flag.Int("max-pages", 0, "Maximum pages to fetch per endpoint (0 = unlimited)")
+	nameSanitize := flag.String("name-sanitize", "minimal", "Account directory naming: minimal, slug, or id-only")
+	countOnly := flag.Bool("count-only", false, "Only report per-resource record counts (no data is fetched)")
+	since := flag.String("since", "", "Insights start date (YYYY-MM-DD)")
+	until := flag.String("until", "", "Insights end date (YYYY-MM-DD)")
+	failOnEmpty := flag.Bool("fail-on-empty-accounts", false, "Exit with an error when the token has no accessible ad accounts")
+	insightsLevel := flag.String("level", "account", "Insights level: account, campaign, adset, or ad")
+	breakdowns := flag.String("breakdowns", "", "Comma-separated insights breakdowns (e.g. age,gender)")
+	timeIncrement := flag.String("time-increment", "", "Insights time_increment (e.g. 1 for daily rows, monthly)")
+	chunkDays := flag.Int("insights-chunk-days", 30, "Split segmented insights queries into windows of this many days (0 = never split)")
+	maskLevel := flag.String("mask-level", "partial", "How access tokens appear in logs: full, partial, or none")
+	resources := flag.String("resources", defaultResources(), "Comma-separated resources to fetch per account")
+	previewFormats := flag.String("preview-formats", "DESKTOP_FEED_STANDARD,MOBILE_FEED_STANDARD", "Comma-separated ad_format values for the previews resource")
+	sortOutput := flag.Bool("sort-output", false, "Sort records (by id, insights by date) for reproducible output")
+	optimizationGoal := flag.String("optimization-goal", "", "optimization_goal for delivery estimates (default: each ad set's own goal)")
+	estimateLimit := flag.Int("delivery-estimate-limit", 0, "Maximum ad sets per account to request delivery estimates for (0 = all)")
+	logFile := flag.String("log-file", "", "Also write log output to this file")
+	logAppend := flag.Bool("log-append", false, "Append to -log-file instead of rotating the previous log to <file>.1")
+	fieldsAll := flag.Bool("fields-all", false, "Request every field of campaigns, ad sets and ads (introspected via metadata)")
+	fieldsCache := flag.String("fields-cache", defaultFieldCachePath(), "File caching -fields-all introspection results (empty disables caching)")
+	fieldsCacheTTL := flag.Duration("fields-cache-ttl", 24*time.Hour, "How long cached -fields-all field lists are reused")
+	accountsFlag := flag.String("accounts", "", "Comma-separated ad account IDs (act_...) to process instead of discovering them")
+	accountsFile := flag.String("accounts-file", "", "File with one ad account ID per line ('#' comments allowed) to process instead of discovering them")
+	progressLines := flag.Bool("progress-lines", false, "Print a parseable DONE line to stdout as each resource completes")
+	validateHierarchy := flag.Bool("validate-hierarchy", false, "Report ads and ad sets whose parent ad set or campaign is missing from the dump")
+	envPrefix := flag.String("env-prefix", "FBADS_", "Prefix of environment variables that supply unset flags (e.g. FBADS_MAX_PAGES)")
+	leadgen := flag.Bool("leadgen", false, "Dump the lead forms of every page the token manages")
+	includeLeads := flag.Bool("include-leads", false, "With -leadgen, also dump submitted leads (personal data, opt-in)")
+	dumpHTTP := flag.Bool("dump-http", false, "Save every request (token masked) and raw response to a debug/ folder")
+	dumpHTTPMax := flag.Int("dump-http-max", 500, "Maximum request/response pairs saved by -dump-http (0 = unlimited)")
+	fileMode := flag.String("file-mode", "0644", "Permissions (octal) for written files")
+	dirMode := flag.String("dir-mode", "0755", "Permissions (octal) for created directories")
+	skipExisting := flag.Bool("skip-existing", false, "Skip resources whose dump file already exists in the account directory and is valid JSON")
+	locale := flag.String("locale", "", "Locale for localized field values, e.g. en_US or fr_FR (default: API default)")
+	parallelPages := flag.Int("parallel-pages", 0, "Fetch offset pages of campaigns, ad sets and ads with this many concurrent workers (0 = sequential cursors)")
+	printVersion := flag.Bool("version", false, "Print version and build information, then exit")
+	aggregateInsights := flag.Bool("aggregate-insights", false, "Add a totals block summing impressions, clicks and spend (with recomputed ctr and cpc) across all insights rows")
+	noRetry := flag.Bool("no-retry", false, "Disable retries and backoff; return the first error immediately")
+	tokenContext := flag.Bool("token-context", false, "Log the user and businesses the token operates as, and dump them to token_context.json")
+	concurrency := flag.Int("concurrency", 1, "Number of accounts to process concurrently")
+	clientCert := flag.String("client-cert", "", "PEM client certificate for gateways that require mutual TLS (needs -client-key)")
+	clientKey := flag.String("client-key", "", "PEM private key for -client-cert")
+	caCert := flag.String("ca-cert", "", "PEM CA certificate to trust in addition to the system roots")
+	consoleMaxBytes := flag.Int64("console-max-bytes", 64*1024, "Print at most this many bytes of each response to the console; files still get the complete data (0 = unlimited)")
+	strictSchema := flag.String("strict-schema", strictSchemaOff, "Write numeric insights fields (spend, impressions, clicks, ...) as JSON numbers instead of strings: off, warn (log unparseable values per row and write them as null) or fail (fail the insights of the account)")
+	apiVersionFlag := flag.String("api-version", defaultAPIVersion, "Graph API version to send requests to, e.g. v20.0, so a sunset version doesn't require a rebuild")
+	objectsFile := flag.String("objects-file", "", "Fetch every object ID listed in this file (one per line, # comments) with the fields for its detected type using batch requests, dump them grouped by type and report the IDs that couldn't be fetched, then exit without dumping accounts")
+	campaignFields := flag.String("campaign-fields", "", "Comma-separated campaign fields to request instead of the defaults (e.g. id,name,effective_status,bid_strategy)")
+	adSetFields := flag.String("adset-fields", "", "Comma-separated ad set fields to request instead of the defaults (e.g. id,name,optimization_goal)")
+	adFields := flag.String("ad-fields", "", "Comma-separated ad fields to request instead of the defaults")
+	expansionRateFactor := flag.Float64("expansion-rate-factor", 4, "Divide the page size of resources whose fields expand nested edges (e.g. adset{name}) by this factor, since expansions count harder against rate limits (1 = no reduction)")
+	encryptKey := flag.String("encrypt-key", "", "Encrypt every output file with AES-256-GCM as <file>.enc, using file:<key file> (32 bytes or 64 hex digits), passfile:<file holding a passphrase> or pass:<passphrase>")
+	decrypt := flag.String("decrypt", "", "Write the decrypted content of a file written with -encrypt-key to stdout, then exit")
+	maxBytes := flag.Int64("max-bytes", 0, "Stop making requests once this many response bytes have been downloaded in the run, writing what was fetched so far (0 = unlimited)")
+	compare := flag.String("compare", "", "Compare two dumps of a resource given as old.json,new.json: print the added and removed IDs and the changed fields of modified objects, then exit")
+	objectID := flag.String("object", "", "Fetch a single campaign, ad set, ad or other object by ID with the fields for its detected type and dump it, then exit without dumping accounts")
+	pruneEmpty := flag.Bool("prune-empty", false, "Remove account directories that end up with no files, e.g. when every resource was skipped or filtered out")
+	var headers headerFlag
+	flag.Var(&headers, "header", "Extra HTTP header as key=value set on every request (repeatable), e.g. X-Env=staging")
+	minImpressions := flag.Int64("min-impressions", 0, "Drop insights rows with fewer than this many impressions before dumping (0 = keep all rows)")
+	targetingSearch := flag.String("targeting-search", "", "Look up the ad interests matching this query, print their IDs and audience sizes (saved to targeting_search.json with -output), then exit without dumping accounts")
+	insightsEnrich := flag.Bool("insights-enrich", false, "At campaign, adset or ad level, add the name, status and budgets of each row's object (from the fetched campaigns, adsets or ads) to the insights rows")
+	retryCodesFlag := flag.String("retry-codes", "", "Comma-separated Graph API error codes to retry with backoff whatever the HTTP status (e.g. 1,2,4,17,341,613)")
+	logFormat := flag.String("log-format", logFormatText, "Log output format: text, or json for one JSON object per line including a final structured error on fatal failures")
+	compressThreshold := flag.Int64("compress-threshold", 0, "Write dump files larger than this many bytes gzip-compressed as <file>.gz, smaller ones as they are (0 = never compress)")
+	syncWindow := flag.Duration("sync-window", 0, "Only fetch campaigns, ad sets and ads updated within this window (e.g. 24h) and insights for the same days")
+	unifiedAttribution := flag.Bool("unified-attribution", false, "Send use_unified_attribution_setting=true (or =false with -unified-attribution=false) with insights queries; omitted unless given")
+	tree := flag.Bool("tree", false, "Also write account_tree.json per account with ad sets nested in their campaigns and ads in their ad sets")
+	budgetAsMajor := flag.Bool("budget-as-major", false, "Convert daily_budget, lifetime_budget, budget_remaining and spend_cap from minor units (cents) to major-unit decimals using the account currency")
+	listResources := flag.Bool("list-resources", false, "Print the resources -resources accepts with the edge each one reads, then exit")
+	maxRunTime := flag.Duration("max-run-time", 0, "Deadline for the whole run (e.g. 2h); retries and rate-limit waits that would pass it are abandoned and remaining accounts are skipped (0 = none)")
+	interval := flag.Duration("interval", 0, "Repeat the dump every interval (e.g. 15m) until interrupted; each cycle writes to a timestamped subdirectory unless -merge-existing or -incremental is set")
+	combineAccounts := flag.Bool("combine-accounts", false, "Also write one <resource>.csv per resource in the output directory with the rows of all accounts and an account_id column")
+	insightsFieldsByLevel := flag.String("insights-fields", "", "Comma-separated insights fields replacing the defaults, or fields per level as space-separated level=fields entries (e.g. \"account=spend,impressions ad=spend,impressions,ctr,actions\"); levels not listed use the defaults")
+	recordFixtures := flag.String("record-fixtures", "", "Save every request and response (tokens removed) as a replayable fixture in this directory")
+	replayFixtures := flag.String("replay-fixtures", "", "Answer requests from fixtures saved with -record-fixtures instead of the network")
+	onEmptyInsights := flag.String("on-empty-insights", emptyInsightsEmpty, "What to write when insights return no rows: empty (an empty data array), marker (adds \"no_data\": true) or skip (no file)")
+	bigQuery := flag.Bool("bigquery", false, "Also write <file>.bq.ndjson and a matching <file>.bq_schema.json for bq load")
+	warmup := flag.Bool("warmup", false, "Make one me request before processing accounts so the connection and token validation are primed")
+	includeUsers := flag.Bool("include-users", false, "Dump the business users and system users of every business the token can see")
+	formats := flag.String("format", formatJSON, "Comma-separated output formats written for every resource: json, csv, ndjson")
+	timeoutMultiplier := flag.Float64("timeout-multiplier", 1.0, "Multiply the request timeout by this on each retry (timeout x multiplier^retry, capped at 10m)")
+	compactSummary := flag.Bool("compact-summary", false, "End with a single key=value summary line on stdout instead of the closing banner")
+	pixelCode := flag.String("pixel-code", redactMask, "How the pixel base code appears in pixels.json: keep, mask or strip")
+	emptyPageTolerance := flag.Int("empty-page-tolerance", 3, "Consecutive empty pages that still carry a cursor to follow before giving up on an edge")
+	insightsExport := flag.Bool("insights-export", false, "Also run insights as an async report and download Facebook's CSV export of it to insights_export.csv")
+	maxRequests := flag.Int("max-requests", 0, "Stop making requests after this many for the whole run, writing what was fetched so far (0 = unlimited)")
+	retryManifest := flag.String("retry-manifest", "", "Re-run only the accounts and resources marked FAILED in this manifest.json, updating it in place")
+	timeouts := flag.String("timeouts", "", "Per-request timeouts by resource, e.g. insights=120s,default=30s (default 30s for everything)")
+	tagRecords := flag.Bool("tag-records", false, "Add a _meta object (run_id, fetched_at, api_version, account_id) to every dumped record")
+	stripURLParamsList := flag.String("strip-url-params", "", "Comma-separated query parameters to remove from URLs in dumped ads and their creatives (e.g. utm_source,fbclid)")
+	discoveryRetries := flag.Int("discovery-retries", 3, "Times to retry account discovery after a transient failure before giving up")
+	logMode := flag.String("log-mode", logModeAuto, "How log lines of concurrently processed accounts are written: auto, stream, buffered or prefixed")
+	mergeExisting := flag.Bool("merge-existing", false, "Merge new insights rows into the account's previous insights dump instead of writing only the new range")
+	mergeKey := flag.String("merge-key", "", "Comma-separated fields identifying an insights row for -merge-existing (default: date_start,date_stop plus the level's ID and breakdowns)")
+	trace := flag.Bool("trace", false, "Log DNS, connect, TLS handshake and time-to-first-byte timings for every request")
+	spendAlertThreshold := flag.Float64("spend-alert-threshold", 0, "Warn when an account's insights spend changes by more than this percent from the previous dump (0 = off)")
+	maxFileSize := flag.Int64("max-file-size", 0, "Split output files larger than this many bytes into numbered parts with an index file (0 = never split)")
+	checksums := flag.Bool("checksums", false, "Write a SHA-256 <file>.sha256 sidecar for every output file and list the checksums in the manifest")
+	insightsFieldsAppend := flag.String("insights-fields-append", "", "Comma-separated insights fields to request in addition to the defaults (e.g. cpm,cpp)")
+	incremental := flag.Bool("incremental", false, "Resume insights from the last dumped date recorded per account (requires -output)")
 	flag.Parse()
 	
+	// The environment is read before any mode that exits early, so
+	// -decrypt and -compare see FBADS_ENCRYPT_KEY and the like too
+	if *envPrefix != "" {
+		if err := bindEnv(flag.CommandLine, *envPrefix, "env-prefix"); err != nil {
+			fatalf("Failed to read configuration from environment: %v", err)
+		}
+	}
+	
+	if *printVersion {
+		fmt.Println(buildInfo())
+		return
+	}
+	if *listResources {
+		printResources(os.Stdout)
+		return
+	}
+	if *decrypt != "" {
+		if err := runDecrypt(*decrypt, *encryptKey, os.Stdout); err != nil {
+			fatalf("Decrypt failed: %v", err)
+		}
+		return
+	}
+	if *compare != "" {
+		if err := runCompare(*compare, *encryptKey, os.Stdout); err != nil {
+			fatalf("Compare failed: %v", err)
+		}
+		return
+	}
+	
+	fileModeValue, err := parseFileMode(*fileMode)
+	if err != nil {
+		fatalf("Invalid -file-mode: %v", err)
+	}
+	dirModeValue, err := parseFileMode(*dirMode)
+	if err != nil {
+		fatalf("Invalid -dir-mode: %v", err)
+	}
+	if *logFile != "" {
+		file, err := setupLogFile(*logFile, *logAppend, fileModeValue)
+		if err != nil {
+			fatalf("Failed to set up log file: %v", err)
+		}
+		defer file.Close()
+	}
+	switch *logFormat {
+	case logFormatText:
+	case logFormatJSON:
+		setupJSONLog()
+	default:
+		fatalf("Invalid -log-format value %q (expected text or json)", *logFormat)
+	}
+	
+	switch *nameSanitize {
+	case "minimal", "slug", "id-only":
+	default:
+		fatalf("Invalid -name-sanitize value %q (expected minimal, slug, or id-only)", *nameSanitize)
+	}
+	
+	for name, value := range map[string]string{"since": *since, "until": *until} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			fatalf("Invalid -%s date %q (expected YYYY-MM-DD)", name, value)
+		}
+	}
+	if effectiveSince, effectiveUntil := insightsRangeOrDefault(*since, *until, time.Now()); effectiveSince > effectiveUntil {
+		fatalf("-since %s is after -until %s", effectiveSince, effectiveUntil)
+	}
+	
+	if *insightsEnrich && *insightsLevel == "account" {
+		fatal("-insights-enrich needs -level campaign, adset or ad")
+	}
+	if *minImpressions < 0 {
+		fatal("-min-impressions must not be negative")
+	}
+	if *consoleMaxBytes < 0 {
+		fatal("-console-max-bytes must not be negative")
+	}
+	if *compressThreshold < 0 {
+		fatal("-compress-threshold must not be negative")
+	}
+	if *syncWindow < 0 {
+		fatal("-sync-window must not be negative")
+	}
+	if *syncWindow > 0 && (*since != "" || *until != "" || *incremental) {
+		fatal("-sync-window sets the insights range itself and can't be combined with -since, -until or -incremental")
+	}
+	
+	switch *insightsLevel {
+	case "account", "campaign", "adset", "ad":
+	default:
+		fatalf("Invalid -level value %q (expected account, campaign, adset, or ad)", *insightsLevel)
+	}
+	
+	switch *maskLevel {
+	case "full", "partial":
+	case "none":
+		log.Println("WARNING: -mask-level none writes the access token to logs in plain text")
+	default:
+		fatalf("Invalid -mask-level value %q (expected full, partial, or none)", *maskLevel)
+	}
+	
+	selectedResources, err := parseResources(*resources)
+	if err != nil {
+		fatalf("Invalid -resources value: %v", err)
+	}
+	
+	accountIDs, err := parseAccountIDs(*accountsFlag)
+	if err != nil {
+		fatalf("Invalid -accounts value: %v", err)
+	}
+	if *accountsFile != "" {
+		fileIDs, err := readAccountsFile(*accountsFile)
+		if err != nil {
+			fatalf("Invalid -accounts-file: %v", err)
+		}
+		accountIDs = append(accountIDs, fileIDs...)
+	}
+	
+	if *includeLeads && !*leadgen {
+		fatal("The -include-leads flag requires -leadgen")
+	}
+	
+	if *locale != "" && !localePattern.MatchString(*locale) {
+		fatalf("Invalid -locale value %q (expected a form like en_US)", *locale)
+	}
+	
+	if *retryManifest != "" && *outputDir == "" {
+		// Account directories in the manifest live next to it
+		*outputDir = filepath.Dir(*retryManifest)
+	}
+	if *incremental && *outputDir == "" {
+		fatal("The -incremental flag requires -output to store per-account state")
+	}
+	if *maxRunTime < 0 {
+		fatal("-max-run-time must not be negative")
+	}
+	if *interval < 0 {
+		fatal("-interval must not be negative")
+	}
+	if *interval > 0 && *retryManifest != "" {
+		fatal("-interval can't be combined with -retry-manifest")
+	}
+	if *combineAccounts && *outputDir == "" {
+		fatal("The -combine-accounts flag requires -output")
+	}
+	
 	if *accessToken == "" {
 		// Check environment variable as fallback
 		envToken := os.Getenv("FB_ACCESS_TOKEN")
 		if envToken == "" {
 			flag.Usage()
-			log.Fatal("The -token flag is required (or set FB_ACCESS_TOKEN environment variable)")
+			fatal("The -token flag is required (or set FB_ACCESS_TOKEN environment variable)")
 		}
 		*accessToken = envToken
 		log.Println("Using access token from FB_ACCESS_TOKEN environment variable")
 	}
 	
+	if *spendAlertThreshold < 0 {
+		fatal("-spend-alert-threshold must not be negative")
+	}
+	if *maxFileSize < 0 {
+		fatal("-max-file-size must not be negative")
+	}
+	timeoutsValue, err := parseTimeouts(*timeouts)
+	if err != nil {
+		fatalf("Invalid -timeouts: %v", err)
+	}
+	switch *pixelCode {
+	case redactKeep, redactMask, redactStrip:
+	default:
+		fatalf("Invalid -pixel-code %q: must be keep, mask or strip", *pixelCode)
+	}
+	if *emptyPageTolerance < 0 {
+		fatal("-empty-page-tolerance must not be negative")
+	}
+	formatList, err := parseFormats(*formats)
+	if err != nil {
+		fatalf("Invalid -format: %v", err)
+	}
+	switch *onEmptyInsights {
+	case emptyInsightsEmpty, emptyInsightsMarker, emptyInsightsSkip:
+	default:
+		fatalf("Invalid -on-empty-insights %q: must be empty, marker or skip", *onEmptyInsights)
+	}
+	switch *strictSchema {
+	case strictSchemaOff, strictSchemaWarn, strictSchemaFail:
+	default:
+		fatalf("Invalid -strict-schema %q: must be off, warn or fail", *strictSchema)
+	}
+	if *timeoutMultiplier < 1 {
+		fatal("-timeout-multiplier must be at least 1")
+	}
+	if !apiVersionPattern.MatchString(*apiVersionFlag) {
+		fatalf("Invalid -api-version %q (expected e.g. %s)", *apiVersionFlag, defaultAPIVersion)
+	}
+	if *expansionRateFactor < 1 {
+		fatal("-expansion-rate-factor must be at least 1")
+	}
+	if *maxBytes < 0 {
+		fatal("-max-bytes must not be negative")
+	}
+	if *maxRequests < 0 {
+		fatal("-max-requests must not be negative")
+	}
+	if *discoveryRetries < 0 {
+		fatal("-discovery-retries must not be negative")
+	}
+	if *concurrency < 1 {
+		fatal("-concurrency must be at least 1")
+	}
+	logModeValue, err := resolveLogMode(*logMode, *concurrency)
+	if err != nil {
+		fatalf("Invalid -log-mode: %v", err)
+	}
+	// Without the flag the parameter is left out, so the API default applies
+	unifiedAttributionValue := ""
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "unified-attribution" {
+			unifiedAttributionValue = strconv.FormatBool(*unifiedAttribution)
+		}
+	})
+	insightsFields, err := insightsFieldList(*insightsFieldsAppend)
+	if err != nil {
+		fatalf("Invalid -insights-fields-append: %v", err)
+	}
+	retryCodes, err := parseRetryCodes(*retryCodesFlag)
+	if err != nil {
+		fatalf("Invalid -retry-codes: %v", err)
+	}
+	levelInsightsFields, err := parseLevelInsightsFields(*insightsFieldsByLevel)
+	if err != nil {
+		fatalf("Invalid -insights-fields: %v", err)
+	}
+	fieldOverrides := make(map[string]string)
+	for resource, value := range map[string]string{"campaigns": *campaignFields, "adsets": *adSetFields, "ads": *adFields} {
+		// Not split on commas, which also appear inside expansions
+		if fields := strings.TrimSpace(value); fields != "" {
+			fieldOverrides[resource] = fields
+		}
+	}
+	
 	// Create output directory if specified
 	if *outputDir != "" {
-		if err := os.MkdirAll(*outputDir, 0755); err != nil {
-			log.Fatalf("Failed to create output directory: %v", err)
+		if err := os.MkdirAll(*outputDir, dirModeValue); err != nil {
+			fatalf("Failed to create output directory: %v", err)
 		}
 	}
 	
 	config := Config{
-		AccessToken: *accessToken,
-		OutputDir:   *outputDir,
-		Debug:       *debug,
-		MaxPages:    *maxPages,
+		AccessToken:         *accessToken,
+		OutputDir:           *outputDir,
+		Debug:               *debug,
+		MaxPages:            *maxPages,
+		NameSanitize:        *nameSanitize,
+		CountOnly:           *countOnly,
+		InsightsSince:       *since,
+		InsightsUntil:       *until,
+		Incremental:         *incremental,
+		InsightsLevel:       *insightsLevel,
+		Breakdowns:          *breakdowns,
+		TimeIncrement:       *timeIncrement,
+		ChunkDays:           *chunkDays,
+		MaskLevel:           *maskLevel,
+		Resources:           selectedResources,
+		PreviewFormats:      splitList(*previewFormats),
+		SortOutput:          *sortOutput,
+		OptimizationGoal:    *optimizationGoal,
+		EstimateLimit:       *estimateLimit,
+		FieldsAll:           *fieldsAll,
+		FieldsCachePath:     *fieldsCache,
+		FieldsCacheTTL:      *fieldsCacheTTL,
+		ProgressLines:       *progressLines,
+		ValidateHierarchy:   *validateHierarchy,
+		Leadgen:             *leadgen,
+		IncludeLeads:        *includeLeads,
+		FileMode:            fileModeValue,
+		DirMode:             dirModeValue,
+		SkipExisting:        *skipExisting,
+		Locale:              *locale,
+		ParallelPages:       *parallelPages,
+		AggregateInsights:   *aggregateInsights,
+		NoRetry:             *noRetry,
+		TokenContext:        *tokenContext,
+		Concurrency:         *concurrency,
+		InsightsFields:      insightsFields,
+		LevelInsightsFields: levelInsightsFields,
+		MaxFileSize:         *maxFileSize,
+		SpendAlertThreshold: *spendAlertThreshold,
+		Trace:               *trace,
+		MergeExisting:       *mergeExisting,
+		MergeKey:            *mergeKey,
+		LogMode:             logModeValue,
+		StripURLParams:      splitList(*stripURLParamsList),
+		TagRecords:          *tagRecords,
+		RunID:               newRunID(time.Now()),
+		Timeouts:            timeoutsValue,
+		MaxRequests:         *maxRequests,
+		InsightsExport:      *insightsExport,
+		EmptyPageTolerance:  *emptyPageTolerance,
+		PixelCode:           *pixelCode,
+		TimeoutMultiplier:   *timeoutMultiplier,
+		Formats:             formatList,
+		IncludeUsers:        *includeUsers,
+		BigQuery:            *bigQuery,
+		OnEmptyInsights:     *onEmptyInsights,
+		BudgetAsMajor:       *budgetAsMajor,
+		Tree:                *tree,
+		CompressThreshold:   *compressThreshold,
+		InsightsEnrich:      *insightsEnrich,
+		ConsoleMaxBytes:     *consoleMaxBytes,
+		MinImpressions:      *minImpressions,
+		Headers:             headers.header,
+		PruneEmpty:          *pruneEmpty,
+		MaxBytes:            *maxBytes,
+		ExpansionRateFactor: *expansionRateFactor,
+		FieldOverrides:      fieldOverrides,
+		APIVersion:          *apiVersionFlag,
+		StrictSchema:        *strictSchema,
+		RetryCodes:          retryCodes,
+		UnifiedAttribution:  unifiedAttributionValue,
+		SyncWindow:          *syncWindow,
 	}
 	
 	client := NewAPIClient(config)
-	
-	log.Println("Starting Facebook Ads API data dump...")
-	if config.MaxPages > 0 {
-		log.Printf("Pagination limit: %d pages per endpoint", config.MaxPages)
-	} else {
-		log.Println("Pagination: unlimited (will fetch all pages)")
+	if *clientCert != "" || *clientKey != "" || *caCert != "" {
+		transport, err := newTransport(*clientCert, *clientKey, *caCert)
+		if err != nil {
+			fatalf("Invalid TLS configuration: %v", err)
+		}
+		client.httpClient.Transport = transport
 	}
-	log.Println("Discovering accessible ad accounts...")
-	
-	// Fetch all accessible ad accounts
-	accounts, err := client.fetchAdAccounts()
-	if err != nil {
-		log.Fatalf("Failed to fetch ad accounts: %v\n\nTroubleshooting tips:\n" +
-			"1. Verify your token is valid: curl \"https://graph.facebook.com/v19.0/me?access_token=YOUR_TOKEN\"\n" +
-			"2. Check token has 'ads_read' permission in Graph API Explorer\n" +
-			"3. Ensure token hasn't expired (long-lived tokens last 60 days)\n" +
-			"4. Use -debug flag for more details\n", err)
+	if *recordFixtures != "" && *replayFixtures != "" {
+		fatal("-record-fixtures and -replay-fixtures can't be combined")
 	}
-	
-	if len(accounts) == 0 {
-		log.Println("No ad accounts found for this access token.")
-		log.Println("Make sure your token has 'ads_read' permission and you have access to at least one ad account.")
+	if *recordFixtures != "" {
+		recorder, err := newRecordingTransport(*recordFixtures, client.httpClient.Transport, config.DirMode)
+		if err != nil {
+			fatalf("Failed to set up -record-fixtures: %v", err)
+		}
+		client.httpClient.Transport = recorder
+		log.Printf("Recording HTTP fixtures to: %s", *recordFixtures)
+	}
+	if *replayFixtures != "" {
+		client.httpClient.Transport = &replayTransport{dir: *replayFixtures}
+		log.Printf("Replaying HTTP fixtures from: %s (no network requests)", *replayFixtures)
+	}
+	if *dumpHTTP {
+		dumpDir := filepath.Join(config.OutputDir, "debug")
+		dumper, err := newHTTPDumper(dumpDir, *dumpHTTPMax, config)
+		if err != nil {
+			fatalf("Failed to set up -dump-http: %v", err)
+		}
+		client.httpDump = dumper
+		log.Printf("Recording HTTP requests and responses to: %s", dumpDir)
+	}
+	if *combineAccounts {
+		client.combined = newCombinedCSV(config.OutputDir)
+	}
+	if config.CompressThreshold > 0 {
+		client.compressed = newCompressedFiles(config.OutputDir)
+	}
+	if *checksums {
+		client.checksums = newChecksumRecorder(config.OutputDir)
+	}
+	if *encryptKey != "" {
+		encryptor, err := newFileEncryptor(*encryptKey)
+		if err != nil {
+			fatalf("Invalid -encrypt-key: %v", err)
+		}
+		client.encryptor = encryptor
+		log.Println("Encrypting output files with AES-256-GCM")
+	}
+	if *objectID != "" && *targetingSearch != "" {
+		fatal("-object and -targeting-search can't be combined")
+	}
+	if *objectsFile != "" && (*objectID != "" || *targetingSearch != "") {
+		fatal("-objects-file can't be combined with -object or -targeting-search")
+	}
+	if *objectsFile != "" {
+		ids, err := readObjectsFile(*objectsFile)
+		if err != nil {
+			fatalf("Invalid -objects-file: %v", err)
+		}
+		if err := client.dumpObjects(ids); err != nil {
+			fatalf("Fetching objects failed: %v", err)
+		}
 		return
 	}
-	
-	log.Printf("Found %d accessible ad account(s)\n", len(accounts))
-	
-	// Process each account
-	successCount := 0
-	for i, account := range accounts {
-		log.Printf("\nProcessing %d/%d: %s", i+1, len(accounts), account.Name)
-		if err := client.processAccount(account); err != nil {
-			log.Printf("Error processing account %s: %v", account.Name, err)
+	if *objectID != "" {
+		if err := client.dumpObject(*objectID); err != nil {
+			fatalf("Fetching object failed: %v", err)
+		}
+		return
+	}
+	if *targetingSearch != "" {
+		if err := client.targetingSearch(*targetingSearch, os.Stdout); err != nil {
+			fatalf("Targeting search failed: %v", err)
+		}
+		return
+	}
+	// runOnce performs one full dump; -interval repeats it. Failures that
+	// end a single run are returned, so -interval can carry on with the
+	// next cycle.
+	runOnce := func(client *APIClient) error {
+		if client.config.SyncWindow > 0 {
+			client.config.applySyncWindow(time.Now())
+			log.Printf("Sync window: objects updated since %s, insights %s to %s",
+				client.config.UpdatedSince.UTC().Format(time.RFC3339), client.config.InsightsSince, client.config.InsightsUntil)
+		}
+		config := client.config
+		var err error
+		startedAt := time.Now()
+		if *maxRunTime > 0 {
+			client.deadline = startedAt.Add(*maxRunTime)
+		}
+		
+		log.Println("Starting Facebook Ads API data dump...")
+		if config.CountOnly {
+			log.Println("Count-only mode: fetching record counts without data")
+		}
+		if config.MaxPages > 0 {
+			log.Printf("Pagination limit: %d pages per endpoint", config.MaxPages)
+		} else {
+			log.Println("Pagination: unlimited (will fetch all pages)")
+		}
+		if config.TokenContext {
+			client.logTokenContext()
+		} else if *warmup {
+			client.warmup()
+		}
+		
+		var accounts []AdAccount
+		var previous Manifest
+		var retryResources map[string]map[string]bool
+		if *retryManifest != "" {
+			previous, err = readManifest(*retryManifest)
+			if err != nil {
+				return fmt.Errorf("invalid -retry-manifest: %w", err)
+			}
+			accounts, retryResources = retryTargets(previous, config.Resources)
+			log.Printf("Retrying failed resources of %d account(s) from %s", len(accounts), *retryManifest)
+			if len(accounts) == 0 {
+				log.Println("Nothing failed in the previous run, nothing to retry.")
+				return nil
+			}
+		} else if len(accountIDs) > 0 {
+			log.Printf("Using %d configured ad account(s), skipping discovery", len(accountIDs))
+			accounts = client.fetchAccountsByID(accountIDs)
 		} else {
-			successCount++
+			log.Println("Discovering accessible ad accounts...")
+			
+			// Fetch all accessible ad accounts
+			accounts, err = client.discoverAccounts(*discoveryRetries)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch ad accounts: %w\n\nTroubleshooting tips:\n" +
+				"1. Verify your token is valid: curl \"%s/me?access_token=YOUR_TOKEN\"\n" +
+				"2. Check token has 'ads_read' permission in Graph API Explorer\n" +
+				"3. Ensure token hasn't expired (long-lived tokens last 60 days)\n" +
+				"4. Use -debug flag for more details\n", err, client.baseURL())
+		}
+		
+		if len(accounts) == 0 {
+			if *failOnEmpty {
+				return errors.New("no ad accounts found for this access token (-fail-on-empty-accounts is set)")
+			}
+			log.Println("No ad accounts found for this access token.")
+			log.Println("Make sure your token has 'ads_read' permission and you have access to at least one ad account.")
+			return nil
+		}
+		
+		log.Printf("Found %d accessible ad account(s)\n", len(accounts))
+		
+		manifest := Manifest{
+			RunID:     config.RunID,
+			Build:     buildInfo(),
+			StartedAt: startedAt,
+			CountOnly: config.CountOnly,
+		}
+		
+		// Process each account
+		// Each account gets its own client copy so rate limiting and page
+		// counts are tracked per account. Entries are stored by the account's
+		// position, so the manifest keeps the discovery order whatever order
+		// the accounts finish in
+		entries := make([]AccountManifest, len(accounts))
+		successCount := 0
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, config.Concurrency)
+		for i, account := range accounts {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, account AdAccount) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				
+				if client.requests.exhausted() || client.downloads.exhausted() || client.abort.aborted() || client.checkDeadline(0) != nil {
+					skipErr := errRequestCap
+					if client.abort.aborted() {
+						skipErr = errTokenInvalidated
+					} else if client.checkDeadline(0) != nil {
+						skipErr = errRunDeadline
+					} else if client.downloads.exhausted() {
+						skipErr = errByteCap
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					log.Printf("Skipping account %s: %v", account.Name, skipErr)
+					client.errors.add(account.ID, "", skipErr)
+					entries[i] = AccountManifest{
+						ID:        account.ID,
+						AccountID: account.AccountID,
+						Name:      account.Name,
+						Error:     skipErr.Error(),
+					}
+					return
+				}
+				
+				accountClient := client.forAccount(account.ID)
+				if retryResources != nil {
+					accountClient.config.Resources = retryResources[account.ID]
+				}
+				flush := accountClient.startAccountLog(account.ID)
+				accountClient.logf("\nProcessing %d/%d: %s", i+1, len(accounts), account.Name)
+				entry, err := accountClient.processAccount(account)
+				if err != nil {
+					accountClient.logf("Error processing account %s: %v", account.Name, err)
+					accountClient.errors.add(account.ID, "", err)
+					entry.Error = err.Error()
+				}
+				flush()
+				
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					successCount++
+				}
+				entries[i] = entry
+			}(i, account)
 		}
+		wg.Wait()
+		for i := range entries {
+			entries[i].PeakUsage = client.limiter.peak(entries[i].ID)
+		}
+		
+		manifestPath := filepath.Join(config.OutputDir, manifestFile)
+		if *retryManifest != "" {
+			// The previous manifest is updated in place
+			applyRetry(&previous, entries)
+			manifest, manifestPath = previous, *retryManifest
+		} else {
+			manifest.Accounts = entries
+		}
+		
+		if client.combined != nil {
+			order := make([]string, len(accounts))
+			for i, account := range accounts {
+				order[i] = account.ID
+			}
+			if err := client.writeCombinedCSVs(order); err != nil {
+				log.Printf("Error writing combined CSVs: %v", err)
+			}
+		}
+		if config.Leadgen {
+			if err := client.dumpLeadgen(); err != nil {
+				log.Printf("Error dumping lead forms: %v", err)
+				client.errors.add("", "leadgen", err)
+			}
+		}
+		if config.IncludeUsers {
+			if err := client.dumpBusinessUsers(); err != nil {
+				log.Printf("Error dumping business users: %v", err)
+				client.errors.add("", "users", err)
+			}
+		}
+		
+		if config.OutputDir != "" {
+			manifest.FinishedAt = time.Now()
+			manifest.BytesDownloaded = client.downloads.count()
+			if client.compressed != nil {
+				manifest.Compressed = client.compressed.all()
+			}
+			if client.checksums != nil {
+				if manifest.Checksums == nil {
+					manifest.Checksums = make(map[string]string)
+				}
+				for file, sum := range client.checksums.all() {
+					manifest.Checksums[file] = sum
+				}
+			}
+			if err := writeManifest(manifestPath, manifest, config.FileMode); err != nil {
+				log.Printf("Error writing manifest: %v", err)
+			} else {
+				log.Printf("Manifest saved to: %s", manifestPath)
+			}
+			errorsPath := filepath.Join(config.OutputDir, errorsFile)
+			if *retryManifest != "" {
+				// Like the manifest, the errors of the retried run are
+				// updated in place rather than overwritten
+				errorsPath = filepath.Join(filepath.Dir(*retryManifest), errorsFile)
+				previousErrors, err := readErrors(errorsPath)
+				if err != nil {
+					log.Printf("Warning: earlier errors not kept: %v", err)
+				}
+				client.errors.mergeRetry(previousErrors, retryResources)
+			}
+			if err := client.errors.write(errorsPath, config.FileMode); err != nil {
+				log.Printf("Error writing errors file: %v", err)
+			} else if n := client.errors.count(); n > 0 {
+				log.Printf("%d error(s) saved to: %s", n, errorsPath)
+			}
+		}
+		
+		if *compactSummary {
+			fmt.Println(compactSummaryLine(entries, client, time.Since(startedAt)))
+			return nil
+		}
+		log.Printf("\n========================================")
+		log.Printf("Data dump complete!")
+		log.Printf("Successfully processed %d/%d accounts", successCount, len(accounts))
+		for _, entry := range entries {
+			if entry.PeakUsage != nil {
+				log.Printf("Account %s peaked at %.0f%% %s usage", entry.ID, entry.PeakUsage.Percent, metricLabels[entry.PeakUsage.Metric])
+			}
+		}
+		log.Printf("========================================\n")
+		return nil
 	}
 	
-	log.Printf("\n========================================")
-	log.Printf("Data dump complete!")
-	log.Printf("Successfully processed %d/%d accounts", successCount, len(accounts))
-	log.Printf("========================================\n")
+	if *interval <= 0 {
+		if err := runOnce(client); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	runPeriodically(client, *interval, runOnce)
 }
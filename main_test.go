@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name, mode, want string
+	}{
+		{"Acme Corp", "minimal", "Acme Corp"},
+		{"Acme/Brand: EU\\West", "minimal", "Acme_Brand_ EU_West"},
+		{"../etc", "minimal", ".._etc"},
+		{"Café Ünïcode", "minimal", "Café Ünïcode"},
+		{"", "minimal", ""},
+		{"Acme Corp", "slug", "acme-corp"},
+		{"  --Leading and  trailing--  ", "slug", "leading-and-trailing"},
+		{"Acme/Brand: EU", "slug", "acmebrand-eu"},
+		{"Snake_case_Name", "slug", "snake-case-name"},
+		{"Café Ünïcode!", "slug", "caf-ncode"},
+		{"日本語", "slug", ""},
+		{"$$$", "slug", ""},
+		{"Acme Corp", "id-only", ""},
+		{"", "id-only", ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeName(tt.name, tt.mode); got != tt.want {
+			t.Errorf("sanitizeName(%q, %q) = %q, want %q", tt.name, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestAccountDirName(t *testing.T) {
+	tests := []struct {
+		name, mode, want string
+	}{
+		{"Acme Corp", "minimal", "123_Acme Corp"},
+		{"  Acme Corp  ", "minimal", "123_Acme Corp"},
+		{"", "minimal", "123"},
+		{"   ", "minimal", "123"},
+		{"\t\n", "minimal", "123"},
+		{"", "slug", "123"},
+		{"   ", "slug", "123"},
+		{"日本語", "slug", "123"},
+		{"Acme Corp", "id-only", "123"},
+	}
+	for _, tt := range tests {
+		account := AdAccount{ID: "act_123", AccountID: "123", Name: tt.name}
+		if got := accountDirName(account, tt.mode); got != tt.want {
+			t.Errorf("accountDirName(%q, %q) = %q, want %q", tt.name, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMaskedRequestURLNeverContainsToken(t *testing.T) {
+	u, err := url.Parse("https://graph.facebook.com/v19.0/act_1/campaigns?fields=id,name&after=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("access_token", testToken)
+	u.RawQuery = query.Encode()
+	finalURL := u.String()
+	
+	for _, level := range []string{"full", "partial"} {
+		masked := maskedRequestURL(*u, query, maskToken(testToken, level))
+		if strings.Contains(masked, testToken) {
+			t.Errorf("%s: masked URL %s contains the token", level, masked)
+		}
+		if !strings.Contains(masked, "after=abc") || !strings.Contains(masked, "fields=id%2Cname") {
+			t.Errorf("%s: masked URL %s lost the other parameters", level, masked)
+		}
+		// Masking must not leak back into the real request, whichever
+		// of the two URLs is built first
+		if query.Get("access_token") != testToken || u.String() != finalURL {
+			t.Fatalf("%s: masking modified the real request URL", level)
+		}
+	}
+}
+
+func TestRequestLogsNeverContainToken(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	
+	failing := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection reset")
+	})
+	for _, transport := range []http.RoundTripper{failing, &pagedTransport{pages: map[string]string{"": page(`{"id":"1"}`, "")}}} {
+		client := newTestClient(transport)
+		client.config.Debug = true
+		client.config.NoRetry = true
+		_, err := client.makeRequest("act_1/campaigns?fields=id")
+		if err != nil && strings.Contains(err.Error(), testToken) {
+			t.Errorf("error contains the token: %v", err)
+		}
+	}
+	if !strings.Contains(logged.String(), "[DEBUG] Request URL: ") {
+		t.Fatalf("request URL was not logged:\n%s", logged.String())
+	}
+	if strings.Contains(logged.String(), testToken) {
+		t.Errorf("log contains the token:\n%s", logged.String())
+	}
+}
+
+func TestFetchPaginatedEmptyMiddlePage(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance int
+		pages     map[string]string
+		want      []string
+	}{
+		{"empty page with next link", 3, map[string]string{
+			"":   page(`{"id":"1"},{"id":"2"}`, "p2"),
+			"p2": page(``, "p3"),
+			"p3": page(`{"id":"3"}`, ""),
+		}, []string{"1", "2", "3"}},
+		{"empty page with only an after cursor", 3, map[string]string{
+			"":   page(`{"id":"1"}`, "p2"),
+			"p2": `{"data":[],"paging":{"cursors":{"after":"p3"}}}`,
+			"p3": page(`{"id":"2"}`, ""),
+		}, []string{"1", "2"}},
+		{"empty pages beyond the tolerance", 1, map[string]string{
+			"":   page(`{"id":"1"}`, "p2"),
+			"p2": page(``, "p3"),
+			"p3": page(``, "p4"),
+			"p4": page(`{"id":"2"}`, ""),
+		}, []string{"1"}},
+	}
+	for _, tt := range tests {
+		client := newTestClient(&pagedTransport{pages: tt.pages})
+		client.config.EmptyPageTolerance = tt.tolerance
+		records, err := client.fetchPaginated("act_1/campaigns?fields=id&limit=2", "campaigns")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := recordIDsOf(t, records); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: IDs = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTimedOutPostIsNotRetried(t *testing.T) {
+	requests := make(map[string]int)
+	client := newTestClient(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests[req.Method]++
+		return nil, context.DeadlineExceeded
+	}))
+	if _, err := client.makePostRequest("act_1/insights", url.Values{"level": {"ad"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("POST err = %v, want a timeout", err)
+	}
+	if _, err := client.makeRequest("act_1/campaigns"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GET err = %v, want a timeout", err)
+	}
+	if requests[http.MethodPost] != 1 || requests[http.MethodGet] != 4 {
+		t.Errorf("sent %d POSTs and %d GETs, want 1 POST and 4 GETs (3 retries)", requests[http.MethodPost], requests[http.MethodGet])
+	}
+}
+
+func TestStartReportRunUsesLevelFields(t *testing.T) {
+	var fields string
+	client := newTestClient(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		fields = req.PostForm.Get("fields")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"report_run_id":"42"}`)),
+			Request:    req,
+		}, nil
+	}))
+	client.config.InsightsFields = "spend,impressions"
+	client.config.InsightsLevel = "ad"
+	client.config.LevelInsightsFields = map[string]string{"ad": "ad_id,ad_name,spend"}
+	
+	if _, err := client.startReportRun("act_1", "2024-01-01", "2024-01-31"); err != nil {
+		t.Fatal(err)
+	}
+	if fields != "ad_id,ad_name,spend" {
+		t.Errorf("report run requested fields %q, want the -insights-fields entry for ad", fields)
+	}
+}
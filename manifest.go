@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const manifestFile = "manifest.json"
+
+const (
+	statusOK      = "OK"
+	statusFailed  = "FAILED"
+	statusSkipped = "SKIPPED"
+)
+
+// Manifest summarizes a run and is written to manifest.json in the output
+// directory once all accounts have been processed.
+type Manifest struct {
+	RunID      string            `json:"run_id"`
+	Build      BuildInfo         `json:"build"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	CountOnly  bool              `json:"count_only,omitempty"`
+	Accounts   []AccountManifest `json:"accounts"`
+	// BytesDownloaded is the total size of all response bodies as received,
+	// compressed where the server sent gzip
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	// Compressed lists the dump files written gzip-compressed because of
+	// -compress-threshold, relative to the output directory
+	Compressed []string `json:"compressed,omitempty"`
+	// Checksums maps output files, relative to the output directory, to
+	// their SHA-256 when -checksums is set
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+type AccountManifest struct {
+	ID        string             `json:"id"`
+	AccountID string             `json:"account_id"`
+	Name      string             `json:"name"`
+	Directory string             `json:"directory,omitempty"`
+	Resources []ResourceManifest `json:"resources"`
+	Orphans   int                `json:"orphans,omitempty"`
+	Spend     *spendChange       `json:"spend_change,omitempty"`
+	PeakUsage *usagePeak         `json:"peak_usage,omitempty"`
+	Error     string             `json:"error,omitempty"` // set when the account could not be processed at all
+}
+
+type ResourceManifest struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+	Error  string `json:"error,omitempty"`
+}
+
+// record appends the outcome of fetching a single resource.
+func (a *AccountManifest) record(resource string, count int, err error) {
+	entry := ResourceManifest{
+		Name:   resource,
+		Status: statusOK,
+		Count:  count,
+	}
+	if err != nil {
+		entry.Status = statusFailed
+		entry.Error = err.Error()
+	}
+	a.Resources = append(a.Resources, entry)
+}
+
+// skip records a resource that was not fetched.
+func (a *AccountManifest) skip(resource string, count int) {
+	a.Resources = append(a.Resources, ResourceManifest{
+		Name:   resource,
+		Status: statusSkipped,
+		Count:  count,
+	})
+}
+
+// failed reports whether the account or any of its resources failed.
+func (a *AccountManifest) failed() bool {
+	if a.Error != "" {
+		return true
+	}
+	for _, r := range a.Resources {
+		if r.Status == statusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// succeeded reports whether the resource was fetched without error.
+func (a *AccountManifest) succeeded(resource string) bool {
+	for _, r := range a.Resources {
+		if r.Name == resource {
+			return r.Status == statusOK
+		}
+	}
+	return false
+}
+
+// compactSummaryLine renders the outcome of a run as one line of
+// key=value pairs for -compact-summary. result is ok when nothing failed,
+// failed when no account came through cleanly and partial otherwise.
+func compactSummaryLine(entries []AccountManifest, client *APIClient, duration time.Duration) string {
+	failed := 0
+	for i := range entries {
+		if entries[i].failed() {
+			failed++
+		}
+	}
+	ok := len(entries) - failed
+	
+	result := "ok"
+	switch {
+	case failed > 0 && ok == 0:
+		result = "failed"
+	case failed > 0:
+		result = "partial"
+	}
+	return fmt.Sprintf("result=%s accounts=%d ok=%d failed=%d requests=%d duration=%s rate_limit_waits=%d",
+		result, len(entries), ok, failed, client.requests.count(), duration.Round(time.Second),
+		atomic.LoadInt64(&client.limiter.waits))
+}
+
+func writeManifest(filename string, manifest Manifest, mode os.FileMode) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	
+	if err := os.WriteFile(filename, data, mode); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// insightsMergeKeys returns the fields identifying an insights row for
+// -merge-existing: the configured keys, or by default the date range plus
+// the level's object ID and any breakdowns.
+func (c *APIClient) insightsMergeKeys() []string {
+	if keys := splitList(c.config.MergeKey); len(keys) > 0 {
+		return keys
+	}
+	keys := []string{"date_start", "date_stop"}
+	if c.config.InsightsLevel != "" && c.config.InsightsLevel != "account" {
+		keys = append(keys, c.config.InsightsLevel+"_id")
+	}
+	return append(keys, splitList(c.config.Breakdowns)...)
+}
+
+// recordFields returns the sorted top-level keys found in any of the
+// records. The Graph API leaves empty metrics out of single rows, so only
+// the keys of all rows together describe the schema.
+func recordFields(records []json.RawMessage) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, raw := range records {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, err
+		}
+		for field := range record {
+			seen[field] = true
+		}
+	}
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// insightsSchema is the sorted list of requested insights fields and
+// breakdowns, stored as "fields" in the summary of an insights dump so a
+// later -merge-existing can tell whether the schema changed.
+func insightsSchema(fields []string, breakdowns string) []string {
+	schema := append(append([]string(nil), fields...), splitList(breakdowns)...)
+	sort.Strings(schema)
+	return schema
+}
+
+// recordKey joins the values of keys in a record into a dedupe key.
+func recordKey(raw json.RawMessage, keys []string) string {
+	var record map[string]interface{}
+	json.Unmarshal(raw, &record)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = jsonScalarString(record[key])
+	}
+	return strings.Join(values, "\x00")
+}
+
+// mergeRecords combines the records of a previous dump with fresh ones.
+// A fresh record replaces a previous record with the same key. Records
+// whose schema differs from the fresh ones (for example after changing
+// -insights-fields-append or -breakdowns) are not merged, since the
+// combined file would mix two schemas. oldFields and newFields are the
+// schemas from insightsSchema; when the previous dump predates them
+// (oldFields is nil) the fields found in the records are compared instead.
+func mergeRecords(previous, fresh []json.RawMessage, keys, oldFields, newFields []string) ([]json.RawMessage, error) {
+	if len(previous) == 0 || len(fresh) == 0 {
+		return append(previous, fresh...), nil
+	}
+	if oldFields == nil || newFields == nil {
+		var err error
+		if oldFields, err = recordFields(previous); err != nil {
+			return nil, fmt.Errorf("parsing previous records: %w", err)
+		}
+		if newFields, err = recordFields(fresh); err != nil {
+			return nil, fmt.Errorf("parsing new records: %w", err)
+		}
+	}
+	if strings.Join(oldFields, ",") != strings.Join(newFields, ",") {
+		return nil, fmt.Errorf("previous records have fields %s, new records have %s",
+			strings.Join(oldFields, ","), strings.Join(newFields, ","))
+	}
+	
+	index := make(map[string]int, len(previous))
+	merged := make([]json.RawMessage, 0, len(previous)+len(fresh))
+	for _, raw := range previous {
+		index[recordKey(raw, keys)] = len(merged)
+		merged = append(merged, raw)
+	}
+	for _, raw := range fresh {
+		key := recordKey(raw, keys)
+		if i, ok := index[key]; ok {
+			merged[i] = raw
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, raw)
+	}
+	return merged, nil
+}
+
+// mergeExistingInsights merges freshly fetched insights rows into the
+// newest insights dump of the account for -merge-existing and returns the
+// combined rows and date range. schema is the insightsSchema of the fresh
+// rows. Without a usable previous dump the fresh rows are returned as they
+// are.
+func (c *APIClient) mergeExistingInsights(accountDir string, rows []json.RawMessage, schema []string, since, until string) ([]json.RawMessage, string, string) {
+	path := latestDump(accountDir, "insights")
+	if path == "" {
+		return rows, since, until
+	}
+	previous, err := readDumpRecords(path, c.dumpKey())
+	if err != nil {
+		c.logf("Warning: not merging with %s: %v", path, err)
+		return rows, since, until
+	}
+	var envelope struct {
+		Summary struct {
+			Since  string   `json:"since"`
+			Until  string   `json:"until"`
+			Fields []string `json:"fields"`
+		} `json:"summary"`
+	}
+	if data, err := readDumpFile(path, c.dumpKey()); err == nil {
+		json.Unmarshal(data, &envelope)
+	}
+	merged, err := mergeRecords(previous, rows, c.insightsMergeKeys(), envelope.Summary.Fields, schema)
+	if err != nil {
+		c.logf("WARNING: not merging with %s, schemas differ: %v", path, err)
+		return rows, since, until
+	}
+	
+	// Widen the range to cover the previous dump
+	if s := envelope.Summary.Since; s != "" && s < since {
+		since = s
+	}
+	if u := envelope.Summary.Until; u > until {
+		until = u
+	}
+	c.logf("Merged %d new insights rows into %d previous rows from %s (%d total)", len(rows), len(previous), path, len(merged))
+	return merged, since, until
+}
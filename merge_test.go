@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func rawRecords(records ...string) []json.RawMessage {
+	raw := make([]json.RawMessage, len(records))
+	for i, record := range records {
+		raw[i] = json.RawMessage(record)
+	}
+	return raw
+}
+
+func TestMergeRecordsRowsWithoutEmptyMetrics(t *testing.T) {
+	keys := []string{"date_start"}
+	// The first previous row has no clicks, as the API leaves empty
+	// metrics out of single rows
+	previous := rawRecords(`{"date_start":"2024-01-01","spend":"1"}`, `{"date_start":"2024-01-02","spend":"2","clicks":"3"}`)
+	fresh := rawRecords(`{"date_start":"2024-01-02","spend":"5","clicks":"4"}`, `{"date_start":"2024-01-03","spend":"6"}`)
+	
+	schema := insightsSchema([]string{"spend", "clicks", "date_start"}, "")
+	for name, oldFields := range map[string][]string{"summary fields": schema, "record fields": nil} {
+		merged, err := mergeRecords(previous, fresh, keys, oldFields, schema)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(merged) != 3 {
+			t.Errorf("%s: merged %d rows, want 3", name, len(merged))
+		}
+	}
+}
+
+func TestMergeRecordsRefusesChangedSchema(t *testing.T) {
+	previous := rawRecords(`{"date_start":"2024-01-01","spend":"1"}`)
+	fresh := rawRecords(`{"date_start":"2024-01-02","spend":"2","reach":"7"}`)
+	if _, err := mergeRecords(previous, fresh, []string{"date_start"},
+		insightsSchema([]string{"date_start", "spend"}, ""), insightsSchema([]string{"date_start", "spend", "reach"}, "")); err == nil {
+		t.Error("merged dumps with different requested fields")
+	}
+	if _, err := mergeRecords(previous, fresh, []string{"date_start"}, nil, nil); err == nil {
+		t.Error("merged records with different fields")
+	}
+}
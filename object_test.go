@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDumpObjectRejectsMalformedIDs(t *testing.T) {
+	client := newTestClient(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("unexpected request %s", req.URL.Path)
+	}))
+	for _, id := range []string{"", "act_", "123/adsets", "../123", "123?fields=id", "act_12a", " 123", "me"} {
+		err := client.dumpObject(id)
+		if err == nil || !strings.Contains(err.Error(), "malformed object ID") {
+			t.Errorf("dumpObject(%q) = %v, want a malformed ID error", id, err)
+		}
+	}
+	// Well-formed IDs get as far as the metadata request
+	for _, id := range []string{"123", "act_123"} {
+		if err := client.dumpObject(id); err == nil || strings.Contains(err.Error(), "malformed") {
+			t.Errorf("dumpObject(%q) = %v, want the request to fail", id, err)
+		}
+	}
+}
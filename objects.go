@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// batchSize is the most requests the Graph API accepts in one batch call.
+const batchSize = 50
+
+var objectIDPattern = regexp.MustCompile(`^(act_)?\d+$`)
+
+// readObjectsFile reads one object ID per line for -objects-file, with the
+// same comment and error handling as readAccountsFile. Duplicates are
+// dropped.
+func readObjectsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening objects file: %w", err)
+	}
+	defer file.Close()
+	
+	var ids, malformed []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !objectIDPattern.MatchString(line) {
+			malformed = append(malformed, fmt.Sprintf("line %d: %q", lineNumber, line))
+			continue
+		}
+		if !seen[line] {
+			seen[line] = true
+			ids = append(ids, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading objects file: %w", err)
+	}
+	if len(malformed) > 0 {
+		return nil, fmt.Errorf("%d malformed object IDs (expected digits or act_<digits>):\n  %s", len(malformed), strings.Join(malformed, "\n  "))
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("objects file lists no IDs")
+	}
+	return ids, nil
+}
+
+// batchResult is the outcome of one request in a batch call.
+type batchResult struct {
+	body []byte
+	err  error
+}
+
+// batchGet sends GET requests for the relative URLs through the Graph API
+// batch endpoint, batchSize at a time, and returns one result per URL in
+// order. A failed batch call fails every request in it.
+func (c *APIClient) batchGet(relativeURLs []string) []batchResult {
+	results := make([]batchResult, len(relativeURLs))
+	for start := 0; start < len(relativeURLs); start += batchSize {
+		end := start + batchSize
+		if end > len(relativeURLs) {
+			end = len(relativeURLs)
+		}
+		c.batchChunk(relativeURLs[start:end], results[start:end])
+	}
+	return results
+}
+
+func (c *APIClient) batchChunk(relativeURLs []string, results []batchResult) {
+	type batchRequest struct {
+		Method      string `json:"method"`
+		RelativeURL string `json:"relative_url"`
+	}
+	requests := make([]batchRequest, len(relativeURLs))
+	for i, relativeURL := range relativeURLs {
+		requests[i] = batchRequest{Method: http.MethodGet, RelativeURL: c.config.APIVersion + "/" + relativeURL}
+	}
+	encoded, err := json.Marshal(requests)
+	if err == nil {
+		var data []byte
+		data, err = c.makePostRequest("", url.Values{"batch": {string(encoded)}})
+		if err == nil {
+			err = parseBatchResponse(data, results)
+		}
+	}
+	if err != nil {
+		for i := range results {
+			results[i].err = fmt.Errorf("batch request failed: %w", err)
+		}
+	}
+}
+
+// parseBatchResponse fills results from a batch response: an array with a
+// status code and body per request, or null for requests the API didn't
+// get to in time.
+func parseBatchResponse(data []byte, results []batchResult) error {
+	var responses []*struct {
+		Code int    `json:"code"`
+		Body string `json:"body"`
+	}
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return fmt.Errorf("parsing batch response: %w", err)
+	}
+	if len(responses) != len(results) {
+		return fmt.Errorf("batch response has %d results for %d requests", len(responses), len(results))
+	}
+	for i, response := range responses {
+		switch {
+		case response == nil:
+			results[i].err = fmt.Errorf("request timed out within the batch")
+		case response.Code != http.StatusOK:
+			results[i].err = batchError(response.Code, response.Body)
+		default:
+			results[i].body = []byte(response.Body)
+		}
+	}
+	return nil
+}
+
+// batchError turns the body of a failed request in a batch into an
+// apiError, as makeRequestWithRetry does for a single request.
+func batchError(status int, body string) error {
+	var errorResponse struct {
+		Error struct {
+			Message   string `json:"message"`
+			Type      string `json:"type"`
+			Code      int    `json:"code"`
+			Subcode   int    `json:"error_subcode"`
+			FBTraceID string `json:"fbtrace_id"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &errorResponse); err != nil {
+		return fmt.Errorf("API error (status %d): %s", status, body)
+	}
+	return &apiError{
+		Status:    status,
+		Message:   errorResponse.Error.Message,
+		Code:      errorResponse.Error.Code,
+		Type:      errorResponse.Error.Type,
+		Subcode:   errorResponse.Error.Subcode,
+		FBTraceID: errorResponse.Error.FBTraceID,
+	}
+}
+
+// failedObject is an entry of the objects_failed dump.
+type failedObject struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// dumpObjects runs -objects-file: like -object for every listed ID, but
+// with the metadata lookups and the fetches each sent as batch calls. The
+// objects are dumped grouped by type as objects_<type>, and IDs that
+// couldn't be fetched are logged and dumped as objects_failed.
+func (c *APIClient) dumpObjects(ids []string) error {
+	var failed []failedObject
+	fail := func(id string, err error) {
+		if isObjectUnavailable(err) {
+			err = fmt.Errorf("does not exist or the token has no access to it: %w", err)
+		}
+		c.logf("Object %s: %v", id, err)
+		failed = append(failed, failedObject{ID: id, Error: err.Error()})
+	}
+	
+	metaURLs := make([]string, len(ids))
+	for i, id := range ids {
+		metaURLs[i] = id + "?metadata=1&fields=id"
+	}
+	var fetchIDs, fetchURLs, kinds []string
+	for i, result := range c.batchGet(metaURLs) {
+		if result.err != nil {
+			fail(ids[i], result.err)
+			continue
+		}
+		meta, err := parseObjectMetadata(result.body)
+		if err != nil {
+			fail(ids[i], err)
+			continue
+		}
+		kind := meta.Type
+		if kind == "" {
+			kind = "unknown"
+		}
+		fetchIDs = append(fetchIDs, ids[i])
+		fetchURLs = append(fetchURLs, fmt.Sprintf("%s?fields=%s", ids[i], c.objectFields(meta)))
+		kinds = append(kinds, kind)
+	}
+	
+	groups := make(map[string][]json.RawMessage)
+	for i, result := range c.batchGet(fetchURLs) {
+		if result.err != nil {
+			fail(fetchIDs[i], result.err)
+			continue
+		}
+		if !json.Valid(result.body) {
+			fail(fetchIDs[i], fmt.Errorf("response is not valid JSON"))
+			continue
+		}
+		groups[kinds[i]] = append(groups[kinds[i]], json.RawMessage(result.body))
+	}
+	
+	kindNames := make([]string, 0, len(groups))
+	for kind := range groups {
+		kindNames = append(kindNames, kind)
+	}
+	sort.Strings(kindNames)
+	fetched := 0
+	for _, kind := range kindNames {
+		records := groups[kind]
+		fetched += len(records)
+		c.logf("Fetched %d object(s) of type %s", len(records), kind)
+		response := map[string]interface{}{
+			"data": records,
+			"summary": map[string]interface{}{
+				"total_count": len(records),
+			},
+		}
+		responseJSON, _ := json.Marshal(response)
+		if err := c.dumpResponse("objects_"+kind, responseJSON, c.config.OutputDir); err != nil {
+			return err
+		}
+	}
+	
+	if len(failed) > 0 {
+		c.logf("%d of %d object(s) couldn't be fetched", len(failed), len(ids))
+		response := map[string]interface{}{
+			"data": failed,
+			"summary": map[string]interface{}{
+				"total_count": len(failed),
+			},
+		}
+		responseJSON, _ := json.Marshal(response)
+		if err := c.dumpResponse("objects_failed", responseJSON, c.config.OutputDir); err != nil {
+			return err
+		}
+	}
+	if fetched == 0 {
+		return fmt.Errorf("none of the %d object(s) could be fetched", len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sortRecords orders records by the given keys, compared as strings in
+// turn, falling back to the raw JSON so the order is total. Map keys need
+// no extra work: encoding/json always writes them sorted.
+func sortRecords(records []json.RawMessage, keys ...string) {
+	type sortable struct {
+		values []string
+		raw    json.RawMessage
+	}
+	items := make([]sortable, len(records))
+	for i, raw := range records {
+		var fields map[string]interface{}
+		json.Unmarshal(raw, &fields)
+		values := make([]string, len(keys))
+		for k, key := range keys {
+			if v, ok := fields[key]; ok {
+				values[k] = jsonScalarString(v)
+			}
+		}
+		items[i] = sortable{values: values, raw: raw}
+	}
+	
+	sort.SliceStable(items, func(i, j int) bool {
+		for k := range keys {
+			if items[i].values[k] != items[j].values[k] {
+				return items[i].values[k] < items[j].values[k]
+			}
+		}
+		return bytes.Compare(items[i].raw, items[j].raw) < 0
+	})
+	
+	for i := range items {
+		records[i] = items[i].raw
+	}
+}
+
+// jsonScalarString renders a decoded JSON value for comparisons.
+func jsonScalarString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// recordIDs extracts the "id" of each record, skipping records without one.
+func recordIDs(records []json.RawMessage) []string {
+	var ids []string
+	for _, raw := range records {
+		var record struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(raw, &record); err == nil && record.ID != "" {
+			ids = append(ids, record.ID)
+		}
+	}
+	return ids
+}
+
+// dumpSuffixes are the endings of the files dumpResponse writes, compressed
+// with -compress-threshold and encrypted with -encrypt-key.
+var dumpSuffixes = []string{".json", ".json.gz", ".json" + encryptedSuffix, ".json.gz" + encryptedSuffix}
+
+// latestDump finds the newest <name>_<unix time>.json (or .json.gz, either
+// of them possibly encrypted) written by dumpResponse in dir and returns
+// its path, or "" when there is none.
+func latestDump(dir, name string) string {
+	latest, latestStamp := "", ""
+	for _, suffix := range dumpSuffixes {
+		matches, _ := filepath.Glob(filepath.Join(dir, name+"_*"+suffix))
+		for _, match := range matches {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), name+"_"), suffix)
+			if stamp == "" || strings.Trim(stamp, "0123456789") != "" {
+				continue
+			}
+			// Equal-length timestamps compare correctly as strings
+			if len(stamp) > len(latestStamp) || (len(stamp) == len(latestStamp) && stamp > latestStamp) {
+				latest, latestStamp = match, stamp
+			}
+		}
+	}
+	return latest
+}
+
+// readDumpRecords returns the data array of a dump written by
+// dumpResponse, following the part files of a split dump. material is
+// the -encrypt-key to read encrypted dumps with, nil if none was given.
+// Only an index lists its parts; in a part file "parts" is their number.
+func readDumpRecords(path string, material *keyMaterial) ([]json.RawMessage, error) {
+	data, err := readDumpFile(path, material)
+	if err != nil {
+		return nil, err
+	}
+	var envelope struct {
+		Data  []json.RawMessage `json:"data"`
+		Parts json.RawMessage   `json:"parts"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	var parts []filePart
+	if trimmed := bytes.TrimSpace(envelope.Parts); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &parts); err != nil {
+			return nil, fmt.Errorf("parsing parts of %s: %w", path, err)
+		}
+	}
+	
+	records := envelope.Data
+	for _, part := range parts {
+		partRecords, err := readDumpRecords(filepath.Join(filepath.Dir(path), part.File), material)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, partRecords...)
+	}
+	return records, nil
+}
+
+// existingDump returns the newest dump of name in dir if it holds valid
+// JSON, together with its record count.
+func existingDump(dir, name string, material *keyMaterial) (string, int, bool) {
+	path := latestDump(dir, name)
+	if path == "" {
+		return "", 0, false
+	}
+	data, err := readDumpFile(path, material)
+	if err != nil || !json.Valid(data) {
+		return "", 0, false
+	}
+	
+	var envelope struct {
+		Data    json.RawMessage `json:"data"`
+		Summary struct {
+			TotalCount *int `json:"total_count"`
+		} `json:"summary"`
+	}
+	json.Unmarshal(data, &envelope)
+	count := 1
+	if envelope.Summary.TotalCount != nil {
+		count = *envelope.Summary.TotalCount
+	}
+	return path, count, true
+}
+
+// pruneAccountDir removes an account directory nothing was written to in
+// this run, for -prune-empty. os.Remove leaves a directory that still
+// holds files from earlier runs alone.
+func (c *APIClient) pruneAccountDir(entry *AccountManifest, accountDir string) {
+	if err := os.Remove(accountDir); err != nil {
+		if c.config.Debug {
+			c.logf("[DEBUG] Keeping %s: %v", accountDir, err)
+		}
+		return
+	}
+	c.logf("Removed empty account directory %s", accountDir)
+	entry.Directory = ""
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// This is a minimal Parquet writer for -format parquet: one row group, one
+// uncompressed PLAIN-encoded data page per column, and the footer in
+// Thrift's compact protocol. It covers the flat schema the dumps need
+// without pulling a dependency into the build.
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types, repetition types, converted types and
+// encodings, as numbered in parquet.thrift.
+const (
+	pqBoolean   = 0
+	pqInt64     = 2
+	pqDouble    = 5
+	pqByteArray = 6
+	
+	pqRequired = 0
+	pqOptional = 1
+	
+	pqUTF8            = 0
+	pqTimestampMillis = 9
+	
+	pqPlain = 0
+	pqRLE   = 3
+)
+
+// parquetRawColumn holds the full JSON of every record.
+const parquetRawColumn = "raw"
+
+// parquetTimeLayouts are the timestamp formats promoted to
+// TIMESTAMP_MILLIS columns: the Graph API's, as in created_time, and
+// RFC 3339.
+var parquetTimeLayouts = []string{"2006-01-02T15:04:05-0700", time.RFC3339}
+
+func parseParquetTime(s string) (time.Time, bool) {
+	for _, layout := range parquetTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+type parquetColumn struct {
+	Name      string
+	Type      int
+	Converted int // -1 when none
+}
+
+// parquetKind classifies a decoded JSON scalar, or returns "" for
+// objects, arrays and nulls. Strings that parse as one of
+// parquetTimeLayouts are timestamps.
+func parquetKind(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		if _, ok := parseParquetTime(value); ok {
+			return "timestamp"
+		}
+		return "string"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	}
+	return ""
+}
+
+// inferParquetSchema promotes the top-level fields holding the same kind
+// of scalar in every record that has them to typed columns, in sorted
+// order. Timestamps mixed with other strings fall back to strings; any
+// other mix, or a nested value, leaves the field in the raw column only.
+func inferParquetSchema(records []map[string]interface{}) []parquetColumn {
+	kinds := make(map[string]string)
+	rejected := make(map[string]bool)
+	for _, record := range records {
+		for key, value := range record {
+			if value == nil || rejected[key] {
+				continue
+			}
+			kind := parquetKind(value)
+			switch {
+			case kind == "" || key == parquetRawColumn:
+				rejected[key] = true
+			case kinds[key] == "" || kinds[key] == kind:
+				kinds[key] = kind
+			case (kinds[key] == "timestamp" && kind == "string") || (kinds[key] == "string" && kind == "timestamp"):
+				kinds[key] = "string"
+			default:
+				rejected[key] = true
+			}
+		}
+	}
+	
+	var columns []parquetColumn
+	for key, kind := range kinds {
+		if rejected[key] {
+			continue
+		}
+		column := parquetColumn{Name: key, Converted: -1}
+		switch kind {
+		case "string":
+			column.Type, column.Converted = pqByteArray, pqUTF8
+		case "timestamp":
+			column.Type, column.Converted = pqInt64, pqTimestampMillis
+		case "bool":
+			column.Type = pqBoolean
+		case "number":
+			column.Type = pqDouble
+		}
+		columns = append(columns, column)
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].Name < columns[j].Name })
+	return columns
+}
+
+// encodeParquet renders records as a Parquet file. Promoted columns are
+// optional; raw is required.
+func encodeParquet(records []map[string]interface{}) ([]byte, error) {
+	columns := inferParquetSchema(records)
+	
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+	
+	var chunks []pqChunk
+	for _, column := range columns {
+		page := encodeParquetColumn(column, records)
+		chunks = append(chunks, writeParquetPage(&file, column, page, len(records)))
+	}
+	
+	raw := pqPage{}
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		pqPlainByteArray(&raw.values, data)
+	}
+	rawColumn := parquetColumn{Name: parquetRawColumn, Type: pqByteArray, Converted: pqUTF8}
+	chunks = append(chunks, writeParquetPage(&file, rawColumn, raw, len(records)))
+	
+	var footer thriftWriter
+	writeParquetFooter(&footer, append(columns, rawColumn), chunks, len(records))
+	file.Write(footer.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(footer.buf.Len()))
+	file.WriteString(parquetMagic)
+	return file.Bytes(), nil
+}
+
+// pqPage is the content of a data page: definition levels (nil for
+// required columns) and the PLAIN-encoded non-null values.
+type pqPage struct {
+	levels []bool
+	values bytes.Buffer
+}
+
+// pqChunk records where a column chunk was written, for the footer.
+type pqChunk struct {
+	offset int64
+	size   int64
+}
+
+func encodeParquetColumn(column parquetColumn, records []map[string]interface{}) pqPage {
+	page := pqPage{levels: make([]bool, len(records))}
+	var bits []bool
+	for i, record := range records {
+		value, ok := record[column.Name]
+		if !ok || value == nil {
+			continue
+		}
+		page.levels[i] = true
+		switch column.Type {
+		case pqBoolean:
+			bits = append(bits, value.(bool))
+		case pqDouble:
+			binary.Write(&page.values, binary.LittleEndian, math.Float64bits(value.(float64)))
+		case pqInt64:
+			t, _ := parseParquetTime(value.(string))
+			binary.Write(&page.values, binary.LittleEndian, t.UnixMilli())
+		case pqByteArray:
+			pqPlainByteArray(&page.values, []byte(jsonScalarString(value)))
+		}
+	}
+	if column.Type == pqBoolean {
+		packed := make([]byte, (len(bits)+7)/8)
+		for i, bit := range bits {
+			if bit {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		page.values.Write(packed)
+	}
+	return page
+}
+
+func pqPlainByteArray(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+}
+
+// encodeDefinitionLevels writes levels of bit width 1 as RLE runs,
+// prefixed with their byte length as data pages v1 expect.
+func encodeDefinitionLevels(levels []bool) []byte {
+	var runs bytes.Buffer
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		writeUvarint(&runs, uint64(j-i)<<1)
+		if levels[i] {
+			runs.WriteByte(1)
+		} else {
+			runs.WriteByte(0)
+		}
+		i = j
+	}
+	out := make([]byte, 4, 4+runs.Len())
+	binary.LittleEndian.PutUint32(out, uint32(runs.Len()))
+	return append(out, runs.Bytes()...)
+}
+
+// writeParquetPage appends a column chunk holding one data page.
+func writeParquetPage(file *bytes.Buffer, column parquetColumn, page pqPage, rows int) pqChunk {
+	var body []byte
+	if page.levels != nil {
+		body = encodeDefinitionLevels(page.levels)
+	}
+	body = append(body, page.values.Bytes()...)
+	
+	var header thriftWriter
+	header.i32(1, 0) // type: DATA_PAGE
+	header.i32(2, int32(len(body)))
+	header.i32(3, int32(len(body)))
+	header.structBegin(5) // data_page_header
+	header.i32(1, int32(rows))
+	header.i32(2, pqPlain)
+	header.i32(3, pqRLE)
+	header.i32(4, pqRLE)
+	header.structEnd()
+	header.stop()
+	
+	offset := int64(file.Len())
+	file.Write(header.buf.Bytes())
+	file.Write(body)
+	return pqChunk{offset: offset, size: int64(file.Len()) - offset}
+}
+
+func writeParquetFooter(w *thriftWriter, columns []parquetColumn, chunks []pqChunk, rows int) {
+	w.i32(1, 1) // version
+	
+	w.listBegin(2, thriftStruct, len(columns)+1) // schema
+	w.elemBegin()
+	w.binary(4, []byte("schema"))
+	w.i32(5, int32(len(columns)))
+	w.elemEnd()
+	for _, column := range columns {
+		w.elemBegin()
+		w.i32(1, int32(column.Type))
+		repetition := int32(pqOptional)
+		if column.Name == parquetRawColumn {
+			repetition = pqRequired
+		}
+		w.i32(3, repetition)
+		w.binary(4, []byte(column.Name))
+		if column.Converted >= 0 {
+			w.i32(6, int32(column.Converted))
+		}
+		w.elemEnd()
+	}
+	
+	w.i64(3, int64(rows))
+	
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.size
+	}
+	w.listBegin(4, thriftStruct, 1) // row_groups
+	w.elemBegin()
+	w.listBegin(1, thriftStruct, len(columns))
+	for i, column := range columns {
+		chunk := chunks[i]
+		w.elemBegin()
+		w.i64(2, chunk.offset) // file_offset
+		w.structBegin(3)       // meta_data
+		w.i32(1, int32(column.Type))
+		w.listBegin(2, thriftI32, 2)
+		w.rawVarint(zigzag(pqPlain))
+		w.rawVarint(zigzag(pqRLE))
+		w.listBegin(3, thriftBinary, 1)
+		w.rawBinary([]byte(column.Name))
+		w.i32(4, 0) // codec: UNCOMPRESSED
+		w.i64(5, int64(rows))
+		w.i64(6, chunk.size)
+		w.i64(7, chunk.size)
+		w.i64(9, chunk.offset) // data_page_offset
+		w.structEnd()
+		w.elemEnd()
+	}
+	w.i64(2, total)
+	w.i64(3, int64(rows))
+	w.elemEnd()
+	
+	w.binary(6, []byte("facebook-ads-api-dumper"))
+	w.stop()
+}
+
+// Thrift compact protocol type IDs.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes structs in Thrift's compact protocol, tracking the
+// last field ID of each open struct for the delta-encoded field headers.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16
+	id   int16
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if delta := id - w.id; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.rawVarint(zigzag(int64(id)))
+	}
+	w.id = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.rawVarint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.rawVarint(zigzag(v))
+}
+
+func (w *thriftWriter) binary(id int16, data []byte) {
+	w.field(id, thriftBinary)
+	w.rawBinary(data)
+}
+
+func (w *thriftWriter) rawBinary(data []byte) {
+	writeUvarint(&w.buf, uint64(len(data)))
+	w.buf.Write(data)
+}
+
+func (w *thriftWriter) rawVarint(v uint64) {
+	writeUvarint(&w.buf, v)
+}
+
+func (w *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	w.buf.WriteByte(0xF0 | elemType)
+	writeUvarint(&w.buf, uint64(size))
+}
+
+// structBegin opens a struct-typed field; elemBegin opens a struct that
+// is a list element and has no field header.
+func (w *thriftWriter) structBegin(id int16) {
+	w.field(id, thriftStruct)
+	w.elemBegin()
+}
+
+func (w *thriftWriter) elemBegin() {
+	w.last = append(w.last, w.id)
+	w.id = 0
+}
+
+func (w *thriftWriter) structEnd() { w.elemEnd() }
+
+func (w *thriftWriter) elemEnd() {
+	w.stop()
+	w.id = w.last[len(w.last)-1]
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) stop() {
+	w.buf.WriteByte(0)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+// writeParquetDump writes the records as <base>.parquet.
+func (c *APIClient) writeParquetDump(base string, formatted []byte) error {
+	records, err := dumpRecords(formatted)
+	if err != nil {
+		return err
+	}
+	data, err := encodeParquet(records)
+	if err != nil {
+		return fmt.Errorf("encoding parquet: %w", err)
+	}
+	filename := base + ".parquet"
+	if err := c.writeOutput(filename, data); err != nil {
+		return err
+	}
+	c.logf("Saved to: %s", filename)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultPageSize = 100
+
+// fetchEdge reads every record of a list edge, prefetching offset pages
+// concurrently when -parallel-pages is set and following cursors otherwise.
+func (c *APIClient) fetchEdge(endpoint string, resourceName string) ([]json.RawMessage, error) {
+	if c.config.ParallelPages > 1 {
+		return c.fetchOffsetPages(endpoint, resourceName)
+	}
+	return c.fetchPaginated(endpoint, resourceName)
+}
+
+// fetchOffsetPages learns the size of the edge from summary=total_count,
+// then requests every offset page with a bounded pool of workers and
+// reassembles the pages in order.
+func (c *APIClient) fetchOffsetPages(endpoint string, resourceName string) ([]json.RawMessage, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	query := parsed.Query()
+	pageSize, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	
+	// The count has to see the same filtering as the pages, or it
+	// overstates the pages to request and -max-pages cuts the wrong total
+	countEdge := parsed.Path
+	if filtering := query.Get("filtering"); filtering != "" {
+		countEdge += "?" + url.Values{"filtering": {filtering}}.Encode()
+	}
+	total, err := c.fetchCount(countEdge, resourceName)
+	if err != nil {
+		return nil, fmt.Errorf("counting %s for parallel fetch: %w", resourceName, err)
+	}
+	
+	pages := (total + pageSize - 1) / pageSize
+	if c.config.MaxPages > 0 && pages > c.config.MaxPages {
+		c.logf("Reached max pages limit (%d) for %s", c.config.MaxPages, resourceName)
+		pages = c.config.MaxPages
+	}
+	if pages == 0 {
+		return nil, nil
+	}
+	c.logf("Requesting: %d pages of %s with %d workers", pages, resourceName, c.config.ParallelPages)
+	
+	results := make([][]json.RawMessage, pages)
+	errs := make([]error, pages)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < c.config.ParallelPages && w < pages; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				pageQuery := url.Values{}
+				for key, values := range query {
+					pageQuery[key] = values
+				}
+				pageQuery.Set("limit", strconv.Itoa(pageSize))
+				pageQuery.Set("offset", strconv.Itoa(page*pageSize))
+				
+				data, err := c.makeRequest(parsed.Path + "?" + pageQuery.Encode())
+				if err != nil {
+					errs[page] = err
+					continue
+				}
+				atomic.AddInt64(&c.pagesFetched, 1)
+				
+				var response PaginatedResponse
+				if err := json.Unmarshal(data, &response); err != nil {
+					errs[page] = fmt.Errorf("parsing page %d: %w", page+1, err)
+					continue
+				}
+				results[page] = response.Data
+			}
+		}()
+	}
+	for page := 0; page < pages; page++ {
+		jobs <- page
+	}
+	close(jobs)
+	wg.Wait()
+	
+	var allData []json.RawMessage
+	for page := range results {
+		if isRunLimit(errs[page]) && len(allData) > 0 {
+			// Keep the pages before the first missing one so they still
+			// get written, as fetchPaginated does
+			c.logf("Stopping %s after %d items: %v", resourceName, len(allData), errs[page])
+			pages = page
+			break
+		}
+		if errs[page] != nil {
+			return nil, errs[page]
+		}
+		allData = append(allData, results[page]...)
+	}
+	c.logf("  Completed: fetched %d items across %d pages for %s", len(allData), pages, resourceName)
+	return allData, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// offsetTransport serves an edge of total records by limit and offset, and
+// answers summary=total_count requests with count.
+type offsetTransport struct {
+	total, count int
+	countQuery   string // raw query of the count request
+}
+
+func (t *offsetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	body := ""
+	if query.Get("summary") == "total_count" {
+		t.countQuery = req.URL.RawQuery
+		body = fmt.Sprintf(`{"data":[],"summary":{"total_count":%d}}`, t.count)
+	} else {
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		var records []string
+		for i := offset; i < offset+limit && i < t.total; i++ {
+			records = append(records, fmt.Sprintf(`{"id":"%d"}`, i+1))
+		}
+		body = `{"data":[` + strings.Join(records, ",") + `]}`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestFetchOffsetPagesCountsWithFiltering(t *testing.T) {
+	transport := &offsetTransport{total: 3, count: 3}
+	client := newTestClient(transport)
+	client.config.ParallelPages = 2
+	endpoint := "act_1/campaigns?fields=id&limit=2" + updatedSinceFilter(time.Unix(1700000000, 0))
+	
+	records, err := client.fetchOffsetPages(endpoint, "campaigns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(transport.countQuery, "filtering=") || !strings.Contains(transport.countQuery, "1700000000") {
+		t.Errorf("count request %q does not carry the filtering", transport.countQuery)
+	}
+	if got := recordIDsOf(t, records); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("IDs = %v, want 1 to 3", got)
+	}
+}
+
+func TestFetchOffsetPagesKeepsPagesBeforeRequestCap(t *testing.T) {
+	client := newTestClient(&offsetTransport{total: 8, count: 8})
+	// One worker takes the pages in order: the count and two pages fit
+	// under the cap, the last two pages don't
+	client.config.ParallelPages = 1
+	client.requests = &requestBudget{max: 3}
+	
+	records, err := client.fetchOffsetPages("act_1/campaigns?fields=id&limit=2", "campaigns")
+	if err != nil {
+		t.Fatalf("err = %v, want the pages before the cap", err)
+	}
+	if got := recordIDsOf(t, records); !reflect.DeepEqual(got, []string{"1", "2", "3", "4"}) {
+		t.Errorf("IDs = %v, want 1 to 4", got)
+	}
+	
+	// Without any page fetched the cap is an error, as in fetchPaginated
+	client = newTestClient(&offsetTransport{total: 8, count: 8})
+	client.config.ParallelPages = 1
+	client.requests = &requestBudget{max: 1}
+	if _, err := client.fetchOffsetPages("act_1/campaigns?fields=id&limit=2", "campaigns"); err == nil {
+		t.Error("request cap before the first page was not reported")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// fetchAdPreviews returns the embeddable preview HTML for an ad rendered in
+// the given ad_format.
+func (c *APIClient) fetchAdPreviews(adID, format string) (string, error) {
+	endpoint := fmt.Sprintf("%s/previews?ad_format=%s", adID, url.QueryEscape(format))
+	data, err := c.makeRequest(endpoint)
+	if err != nil {
+		return "", err
+	}
+	
+	var response struct {
+		Data []struct {
+			Body string `json:"body"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", fmt.Errorf("parsing preview response: %w", err)
+	}
+	if len(response.Data) == 0 {
+		return "", fmt.Errorf("no preview returned")
+	}
+	return response.Data[0].Body, nil
+}
+
+// fetchPreviews writes previews/<ad_id>_<format>.html for every ad and
+// configured format. When the ads resource was not fetched, the ad IDs are
+// listed first.
+func (c *APIClient) fetchPreviews(accountID string, ads []json.RawMessage, accountDir string) (int, error) {
+	if ads == nil {
+		var err error
+		ads, err = c.fetchPaginated(fmt.Sprintf("%s/ads?fields=id&limit=100", accountID), "ads")
+		if err != nil {
+			return 0, fmt.Errorf("listing ads for previews: %w", err)
+		}
+	}
+	
+	var previewDir string
+	if accountDir != "" {
+		previewDir = filepath.Join(accountDir, "previews")
+		if err := os.MkdirAll(previewDir, c.config.DirMode); err != nil {
+			return 0, fmt.Errorf("creating previews directory: %w", err)
+		}
+	}
+	
+	c.logf("Requesting: previews for %d ads in %d formats", len(ads), len(c.config.PreviewFormats))
+	written, attempted := 0, 0
+	var lastErr error
+	for _, adID := range recordIDs(ads) {
+		for _, format := range c.config.PreviewFormats {
+			attempted++
+			body, err := c.fetchAdPreviews(adID, format)
+			if err != nil {
+				// One unrenderable ad shouldn't stop the rest
+				c.logf("  Error fetching %s preview for ad %s: %v", format, adID, err)
+				lastErr = err
+				continue
+			}
+			
+			if previewDir == "" {
+				fmt.Printf("\n=== preview %s %s ===\n%s\n\n", adID, format, body)
+			} else {
+				filename := filepath.Join(previewDir, fmt.Sprintf("%s_%s.html", adID, format))
+				if err := c.writeOutput(filename, []byte(body)); err != nil {
+					return written, fmt.Errorf("writing preview: %w", err)
+				}
+			}
+			written++
+		}
+	}
+	
+	if written == 0 && attempted > 0 {
+		return 0, fmt.Errorf("all %d preview requests failed, last error: %w", attempted, lastErr)
+	}
+	if previewDir != "" {
+		c.logf("Saved %d previews to: %s", written, previewDir)
+	}
+	return written, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throttleThreshold is the usage percentage, as reported in the usage
+// headers, at which requests for an account are paused.
+const throttleThreshold = 90
+
+// defaultThrottlePause is used when the usage headers report high usage
+// without an estimated time to regain access.
+const defaultThrottlePause = 60 * time.Second
+
+// rateLimiter keeps throttle state per ad account, so that one account
+// nearing its business use case limit does not slow down the others.
+// Requests that are not tied to an account share the "" entry.
+type rateLimiter struct {
+	mu     sync.Mutex
+	paused map[string]time.Time
+	peaks  map[string]usagePeak // highest usage seen per account in the run
+	waits  int64                // times a request had to wait, for -compact-summary
+}
+
+// usagePeak is the highest usage percentage the usage headers reported for
+// an account, and the metric it was reported for.
+type usagePeak struct {
+	Percent float64 `json:"percent"`
+	Metric  string  `json:"metric"` // call_count, total_cputime, total_time or acc_id_util_pct
+}
+
+// metricLabels name the usage metrics in the end-of-run summary.
+var metricLabels = map[string]string{
+	"call_count":      "call-count",
+	"total_cputime":   "CPU-time",
+	"total_time":      "total-time",
+	"acc_id_util_pct": "ad-account",
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{paused: make(map[string]time.Time), peaks: make(map[string]usagePeak)}
+}
+
+// peak returns the highest usage seen for the account, or nil when no
+// usage header came back for it.
+func (r *rateLimiter) peak(accountID string) *usagePeak {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peak, ok := r.peaks[accountID]
+	if !ok {
+		return nil
+	}
+	return &peak
+}
+
+// resetPeaks forgets the usage peaks, for the next -interval cycle.
+func (r *rateLimiter) resetPeaks() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peaks = make(map[string]usagePeak)
+}
+
+// remaining returns how long the account stays paused.
+func (r *rateLimiter) remaining(accountID string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Until(r.paused[accountID])
+}
+
+// wait blocks until the account is no longer paused.
+func (r *rateLimiter) wait(accountID string) {
+	if d := r.remaining(accountID); d > 0 {
+		atomic.AddInt64(&r.waits, 1)
+		log.Printf("Account %s is throttled, waiting %v", accountLabel(accountID), d.Round(time.Second))
+		time.Sleep(d)
+	}
+}
+
+// pause holds back further requests for the account for at least d.
+func (r *rateLimiter) pause(accountID string, d time.Duration) {
+	until := time.Now().Add(d)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if until.After(r.paused[accountID]) {
+		r.paused[accountID] = until
+	}
+}
+
+// observe inspects the usage headers of a response and pauses the account
+// when it is close to its limit.
+func (r *rateLimiter) observe(accountID string, header http.Header) {
+	usage, metric, regain := parseUsageHeaders(header)
+	if metric != "" {
+		r.mu.Lock()
+		if peak, ok := r.peaks[accountID]; !ok || usage > peak.Percent {
+			r.peaks[accountID] = usagePeak{Percent: usage, Metric: metric}
+		}
+		r.mu.Unlock()
+	}
+	if regain <= 0 && usage < throttleThreshold {
+		return
+	}
+	
+	wait := regain
+	if wait <= 0 {
+		wait = defaultThrottlePause
+	}
+	log.Printf("Account %s at %.0f%% of its rate limit, pausing its requests for %v",
+		accountLabel(accountID), usage, wait)
+	r.pause(accountID, wait)
+}
+
+func accountLabel(accountID string) string {
+	if accountID == "" {
+		return "(none)"
+	}
+	return accountID
+}
+
+// parseUsageHeaders returns the highest usage percentage reported by the
+// X-Business-Use-Case-Usage, X-Ad-Account-Usage and X-App-Usage headers,
+// the metric it was reported for ("" when no header was present) and the
+// longest estimated time until access is regained.
+func parseUsageHeaders(header http.Header) (float64, string, time.Duration) {
+	var usage float64
+	var metric string
+	var regain time.Duration
+	consider := func(value float64, name string) {
+		if metric == "" || value > usage {
+			usage, metric = value, name
+		}
+	}
+	
+	if raw := header.Get("X-Business-Use-Case-Usage"); raw != "" {
+		var buc map[string][]struct {
+			CallCount                   float64 `json:"call_count"`
+			TotalCPUTime                float64 `json:"total_cputime"`
+			TotalTime                   float64 `json:"total_time"`
+			EstimatedTimeToRegainAccess float64 `json:"estimated_time_to_regain_access"`
+		}
+		if err := json.Unmarshal([]byte(raw), &buc); err == nil {
+			for _, entries := range buc {
+				for _, e := range entries {
+					consider(e.CallCount, "call_count")
+					consider(e.TotalCPUTime, "total_cputime")
+					consider(e.TotalTime, "total_time")
+					if d := time.Duration(e.EstimatedTimeToRegainAccess) * time.Minute; d > regain {
+						regain = d
+					}
+				}
+			}
+		}
+	}
+	
+	if raw := header.Get("X-Ad-Account-Usage"); raw != "" {
+		var account struct {
+			UtilPct           float64 `json:"acc_id_util_pct"`
+			ResetTimeDuration float64 `json:"reset_time_duration"`
+		}
+		if err := json.Unmarshal([]byte(raw), &account); err == nil {
+			consider(account.UtilPct, "acc_id_util_pct")
+			if account.UtilPct >= throttleThreshold {
+				if d := time.Duration(account.ResetTimeDuration) * time.Second; d > regain {
+					regain = d
+				}
+			}
+		}
+	}
+	
+	if raw := header.Get("X-App-Usage"); raw != "" {
+		var app struct {
+			CallCount    float64 `json:"call_count"`
+			TotalCPUTime float64 `json:"total_cputime"`
+			TotalTime    float64 `json:"total_time"`
+		}
+		if err := json.Unmarshal([]byte(raw), &app); err == nil {
+			consider(app.CallCount, "call_count")
+			consider(app.TotalCPUTime, "total_cputime")
+			consider(app.TotalTime, "total_time")
+		}
+	}
+	
+	return usage, metric, regain
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+)
+
+const (
+	redactKeep  = "keep"
+	redactMask  = "mask"
+	redactStrip = "strip"
+)
+
+// redactedValue replaces masked fields, matching how maskToken writes a
+// fully masked token.
+const redactedValue = "***"
+
+// redactFields masks or removes the named top-level fields of each record,
+// depending on mode. Records that aren't JSON objects are left as they are.
+func redactFields(records []json.RawMessage, mode string, fields ...string) []json.RawMessage {
+	if mode == redactKeep {
+		return records
+	}
+	masked, _ := json.Marshal(redactedValue)
+	for i, raw := range records {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &record); err != nil || record == nil {
+			continue
+		}
+		changed := false
+		for _, field := range fields {
+			if _, ok := record[field]; !ok {
+				continue
+			}
+			if mode == redactStrip {
+				delete(record, field)
+			} else {
+				record[field] = masked
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if redacted, err := json.Marshal(record); err == nil {
+			records[i] = redacted
+		}
+	}
+	return records
+}
+
+// tokenParamPattern and tokenFieldPattern find access tokens in response
+// bodies: as a query parameter of paging.next links, and as the
+// access_token field of the page tokens me/accounts returns.
+var (
+	tokenParamPattern = regexp.MustCompile(`(access_token=)([^&"'\s\\]+)`)
+	tokenFieldPattern = regexp.MustCompile(`("access_token"\s*:\s*")([^"\\]*)`)
+)
+
+// redactTokens masks every access token in data with maskToken at the
+// given level, for response bodies written to disk.
+func redactTokens(data []byte, level string) []byte {
+	for _, pattern := range []*regexp.Regexp{tokenParamPattern, tokenFieldPattern} {
+		data = pattern.ReplaceAllFunc(data, func(match []byte) []byte {
+			parts := pattern.FindSubmatch(match)
+			return append(append([]byte(nil), parts[1]...), maskToken(string(parts[2]), level)...)
+		})
+	}
+	return data
+}
+
+// sensitiveHeaders carry credentials and are masked wherever headers are
+// written to disk.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"Set-Cookie":          true,
+}
+
+// redactHeaders returns a copy of header with the sensitiveHeaders and the
+// headers named in custom, from -header, replaced by redactedValue.
+func redactHeaders(header, custom http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[name] || custom[name] != nil {
+			redacted[name] = []string{redactedValue}
+			continue
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
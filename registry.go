@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	pixelFields        = "id,name,code,last_fired_time,is_created_by_business"
+	adRuleFields       = "id,name,status,evaluation_spec,execution_spec"
+	adLabelFields      = "id,name,created_time"
+	rfPredictionFields = "id,campaign_group_id,frequency_cap,target_spec,prediction_progress,reservation_status"
+	offlineSetFields   = "id,name,event_stats,is_mta_use"
+)
+
+// Resource describes a per-account resource that can be selected with
+// -resources. List edges of the account are read and dumped by
+// fetchResource; resources that need more than that have a Fetch method.
+type Resource struct {
+	Name        string // resource name for -resources, the manifest and the dump file
+	Label       string // used in progress lines
+	Description string // shown by -list-resources
+	Default     bool   // fetched when -resources is not given
+	Edge        string // path below the account, such as "campaigns"
+	// Path is the Graph API path -list-resources shows for resources that
+	// are not read from an account edge
+	Path   string
+	Fields string // default fields
+	// Countable edges support summary=total_count for -count-only
+	Countable bool
+	// ObjectType is the node type behind the edge; when set -fields-all
+	// expands the fields by introspection and -parallel-pages may
+	// prefetch offset pages
+	ObjectType string
+	Paginated  bool // follow paging cursors instead of reading one page
+	// Updated marks edges filterable on updated_time, which -sync-window
+	// uses to fetch only recently changed objects
+	Updated bool
+	// Labeled edges also request the adlabels field when the adlabels
+	// resource is selected
+	Labeled bool
+	// OptionalAccess reports a permission error as an empty resource
+	// instead of a failure, for edges that need extra access
+	OptionalAccess bool
+	// ExpandFields adds what other options need to the fields requested
+	ExpandFields func(c *APIClient, fields string) string
+	// Transform adjusts the records before they are tagged and sorted
+	Transform func(c *APIClient, records []json.RawMessage) []json.RawMessage
+	// Fetch replaces fetchResource for resources that are not a plain
+	// list edge, and returns the number of records written
+	Fetch func(c *APIClient, run *accountRun) (int, error)
+	// After runs once the resource is done or was not selected, for the
+	// steps that depend on it
+	After func(c *APIClient, run *accountRun)
+}
+
+// knownResources lists every resource in the order processAccount fetches
+// them; later entries may use the records of earlier ones.
+var knownResources = []Resource{
+	{Name: "ad_account", Label: "ad account details", Description: "Ad account details and billing information", Default: true, Path: "act_<id>",
+		Fetch: func(c *APIClient, run *accountRun) (int, error) {
+			return 1, c.fetchAdAccount(run.accountID, run.accountDir)
+		}},
+	{Name: "account_settings", Label: "account settings", Description: "Account limits and settings such as minimum daily budget, capabilities and attribution", Path: "act_<id>",
+		Fetch: func(c *APIClient, run *accountRun) (int, error) {
+			return 1, c.fetchAccountSettings(run.accountID, run.accountDir)
+		}},
+	{Name: "campaigns", Label: "campaigns", Description: "All campaigns in the account", Default: true, Edge: "campaigns", Fields: defaultCampaignFields, Countable: true,
+		ObjectType: "campaign", Paginated: true, Updated: true, Labeled: true,
+		Transform: (*APIClient).budgetsAsMajor},
+	{Name: "adsets", Label: "ad sets", Description: "All ad sets in the account", Default: true, Edge: "adsets", Fields: defaultAdSetFields, Countable: true,
+		ObjectType: "adset", Paginated: true, Updated: true, Labeled: true,
+		Transform: (*APIClient).budgetsAsMajor},
+	{Name: "ads", Label: "ads", Description: "All ads in the account", Default: true, Edge: "ads", Fields: defaultAdFields, Countable: true,
+		ObjectType: "ad", Paginated: true, Updated: true, Labeled: true,
+		ExpandFields: func(c *APIClient, fields string) string {
+			if len(c.config.StripURLParams) == 0 {
+				return fields
+			}
+			return expandCreativeFields(fields)
+		},
+		Transform: func(c *APIClient, records []json.RawMessage) []json.RawMessage {
+			if len(c.config.StripURLParams) == 0 {
+				return records
+			}
+			return stripRecordURLParams(records, c.config.StripURLParams)
+		},
+		After: (*APIClient).afterObjects},
+	{Name: "insights", Label: "insights", Description: "Performance insights for the configured date range", Default: true, Edge: "insights",
+		Fetch: func(c *APIClient, run *accountRun) (int, error) {
+			// Look up the previous dump before it stops being the newest one
+			run.previousInsights = latestDump(run.accountDir, "insights")
+			return c.fetchInsights(run.accountID, run.accountDir)
+		},
+		After: (*APIClient).afterInsights},
+	{Name: "previews", Label: "ad previews", Description: "Rendered ad previews, one HTML file per ad and format", Path: "<ad_id>/previews",
+		Fetch: func(c *APIClient, run *accountRun) (int, error) {
+			return c.fetchPreviews(run.accountID, run.records["ads"], run.accountDir)
+		}},
+	{Name: "delivery_estimates", Label: "delivery estimates", Description: "Delivery estimates for each ad set", Path: "<adset_id>/delivery_estimate",
+		Fetch: func(c *APIClient, run *accountRun) (int, error) {
+			return c.fetchDeliveryEstimates(run.accountID, run.records["adsets"], run.accountDir)
+		}},
+	{Name: "adset_identities", Label: "ad set identities", Description: "Page and Instagram identity promoted by each ad set", Path: "act_<id>/adsets (promoted_object)",
+		Fetch: func(c *APIClient, run *accountRun) (int, error) {
+			return c.fetchAdSetIdentities(run.accountID, run.accountDir)
+		}},
+	// The pixel base code is masked or removed according to -pixel-code
+	{Name: "pixels", Label: "pixels", Description: "Tracking pixels of the account", Edge: "adspixels", Fields: pixelFields, Paginated: true,
+		Transform: func(c *APIClient, records []json.RawMessage) []json.RawMessage {
+			return redactFields(records, c.config.PixelCode, "code")
+		}},
+	// Reading the rules library needs access the token may not have
+	{Name: "adrules", Label: "automated rules", Description: "Automated rules from the account's rules library", Edge: "adrules_library", Fields: adRuleFields, Paginated: true, OptionalAccess: true},
+	{Name: "adlabels", Label: "ad labels", Description: "Ad labels of the account; also adds the adlabels field to campaigns, ad sets and ads", Edge: "adlabels", Fields: adLabelFields, Paginated: true},
+	{Name: "rf_predictions", Label: "reach and frequency predictions", Description: "Reach and frequency predictions of the account", Edge: "reachfrequencypredictions", Fields: rfPredictionFields, Paginated: true},
+	// Offline event sets are usually shared from a business, which the
+	// token may not have access to
+	{Name: "offline_conversion_datasets", Label: "offline conversion data sets", Description: "Offline conversion data sets the account uses, with event stats", Edge: "offline_conversion_data_sets", Fields: offlineSetFields, Paginated: true, OptionalAccess: true},
+}
+
+// listedPath returns the Graph API path -list-resources shows.
+func (r Resource) listedPath() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return "act_<id>/" + r.Edge
+}
+
+// accountRun is the state of one account shared by the resources of
+// processAccount.
+type accountRun struct {
+	entry      *AccountManifest
+	accountID  string
+	accountDir string
+	// records holds what fetchResource read, by resource name
+	records          map[string][]json.RawMessage
+	previousInsights string
+}
+
+// fetchResources fetches every resource selected with -resources in
+// registry order and records the outcomes.
+func (c *APIClient) fetchResources(run *accountRun) {
+	for _, r := range knownResources {
+		if c.wants(r.Name) {
+			c.trackResource(run, r)
+		}
+		if r.After != nil {
+			r.After(c, run)
+		}
+	}
+}
+
+// trackResource fetches one resource and records the outcome. The records
+// of list edges are kept in run for the resources that depend on them.
+func (c *APIClient) trackResource(run *accountRun, r Resource) {
+	c.track(run.entry, r.Name, r.Label, func() (int, error) {
+		if r.Fetch != nil {
+			return r.Fetch(c, run)
+		}
+		records, err := c.fetchResource(run.accountID, run.accountDir, r)
+		run.records[r.Name] = records
+		return len(records), err
+	})
+}
+
+// afterObjects runs the checks that need campaigns, ad sets and ads
+// together, and picks the objects insights are enriched with.
+func (c *APIClient) afterObjects(run *accountRun) {
+	campaigns, adsets, ads := run.records["campaigns"], run.records["adsets"], run.records["ads"]
+	if c.config.ValidateHierarchy {
+		c.checkHierarchy(run.entry, campaigns, adsets, ads, run.accountDir)
+	}
+	if c.config.Tree && run.accountDir != "" {
+		c.writeAccountTree(run.entry, campaigns, adsets, ads, run.accountDir)
+	}
+	
+	if c.config.InsightsEnrich {
+		resource := insightsLevelResource(c.config.InsightsLevel)
+		c.levelObjects = run.records[resource]
+		if resource != "" && !run.entry.succeeded(resource) {
+			c.logf("Not enriching insights: %s were not fetched", resource)
+			c.levelObjects = nil
+		}
+	}
+}
+
+// afterInsights compares the spend with the previous dump and runs the
+// asynchronous insights export.
+func (c *APIClient) afterInsights(run *accountRun) {
+	if c.wants("insights") && c.config.SpendAlertThreshold > 0 && run.accountDir != "" && run.entry.succeeded("insights") {
+		c.compareSpend(run.entry, run.accountDir, run.previousInsights)
+	}
+	if c.config.InsightsExport {
+		c.track(run.entry, "insights_export", "insights export", func() (int, error) {
+			return c.fetchInsightsExport(run.accountID, run.accountDir)
+		})
+	}
+}
+
+// fetchResource reads every record of an edge resource and dumps them as
+// a {data, summary} envelope.
+func (c *APIClient) fetchResource(accountID, accountDir string, r Resource) ([]json.RawMessage, error) {
+	fields := r.Fields
+	if override, ok := c.config.FieldOverrides[r.Name]; ok {
+		fields = override
+	} else if r.ObjectType != "" {
+		fields = c.resourceFields(accountID, r.Edge, r.ObjectType, r.Fields)
+	}
+	if r.Labeled && c.wants("adlabels") && !containsField(fields, "adlabels") {
+		fields += ",adlabels"
+	}
+	if r.ExpandFields != nil {
+		fields = r.ExpandFields(c, fields)
+	}
+	limit := c.pageLimit(fields)
+	if limit < defaultPageLimit {
+		c.logf("Fields of %s expand nested edges, reading %d instead of %d per page", r.Label, limit, defaultPageLimit)
+	}
+	endpoint := fmt.Sprintf("%s/%s?fields=%s&limit=%d", accountID, r.Edge, fields, limit)
+	if r.Updated && !c.config.UpdatedSince.IsZero() {
+		endpoint += updatedSinceFilter(c.config.UpdatedSince)
+	}
+	
+	var allData []json.RawMessage
+	var err error
+	switch {
+	case r.Paginated && r.ObjectType != "":
+		allData, err = c.fetchEdge(endpoint, r.Name)
+	case r.Paginated:
+		allData, err = c.fetchPaginated(endpoint, r.Name)
+	default:
+		allData, err = c.fetchPage(endpoint, r.Name)
+	}
+	if err != nil {
+		if r.OptionalAccess && isPermissionError(err) {
+			c.logf("Token has no access to %s of %s, skipping: %v", r.Label, accountID, err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	
+	if r.Transform != nil {
+		allData = r.Transform(c, allData)
+	}
+	allData = c.tagRecords(allData)
+	if c.config.SortOutput {
+		sortRecords(allData, "id")
+	}
+	
+	summary := map[string]interface{}{
+		"total_count": len(allData),
+	}
+	if containsField(fields, "effective_status") {
+		summary["effective_status_counts"] = countByField(allData, "effective_status")
+	}
+	response := map[string]interface{}{
+		"data":    allData,
+		"summary": summary,
+	}
+	responseJSON, _ := json.Marshal(response)
+	return allData, c.dumpResponse(r.Name, responseJSON, accountDir)
+}
+
+// countByField counts the records per value of a string field, so the
+// summary shows e.g. how many ads are ACTIVE and how many CAMPAIGN_PAUSED.
+// Records without the field are not counted.
+func countByField(records []json.RawMessage, field string) map[string]int {
+	counts := make(map[string]int)
+	for _, raw := range records {
+		var record map[string]interface{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		if value, ok := record[field].(string); ok {
+			counts[value]++
+		}
+	}
+	return counts
+}
+
+// defaultPageLimit is the page size requested from list edges.
+const defaultPageLimit = 100
+
+// pageLimit returns the page size for a field list. Expansions such as
+// adset{name,status} make the API resolve nested edges for every object,
+// which costs far more against the rate limits than plain fields, so the
+// page is shrunk by -expansion-rate-factor.
+func (c *APIClient) pageLimit(fields string) int {
+	if !strings.Contains(fields, "{") || c.config.ExpansionRateFactor <= 1 {
+		return defaultPageLimit
+	}
+	limit := int(float64(defaultPageLimit) / c.config.ExpansionRateFactor)
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+func containsField(fields, field string) bool {
+	for _, f := range splitList(fields) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchPage reads the first page of an edge only.
+func (c *APIClient) fetchPage(endpoint, resourceName string) ([]json.RawMessage, error) {
+	c.logf("Requesting: %s (first page only)", resourceName)
+	data, err := c.makeRequest(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	var response PaginatedResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", resourceName, err)
+	}
+	return response.Data, nil
+}
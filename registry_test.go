@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestKnownResourcesAreConsistent(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, r := range knownResources {
+		if seen[r.Name] {
+			t.Errorf("%s is registered twice", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Label == "" || r.Description == "" {
+			t.Errorf("%s has no label or description", r.Name)
+		}
+		if r.Fetch == nil && (r.Edge == "" || r.Fields == "") {
+			t.Errorf("%s has neither a Fetch method nor an edge with fields", r.Name)
+		}
+		if r.Countable && r.Edge == "" {
+			t.Errorf("%s is countable without an edge", r.Name)
+		}
+		if _, err := parseResources(r.Name); err != nil {
+			t.Errorf("parseResources(%q): %v", r.Name, err)
+		}
+	}
+	if _, err := parseResources("campaigns,nonsense"); err == nil {
+		t.Error("parseResources accepted an unknown resource")
+	}
+	if got, want := defaultResources(), "ad_account,campaigns,adsets,ads,insights"; got != want {
+		t.Errorf("defaultResources() = %q, want %q", got, want)
+	}
+}
+
+func TestProcessAccountFetchesSelectedResources(t *testing.T) {
+	var paths []string
+	client := newTestClient(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"data":[{"id":"1"},{"id":"2"}]}`)),
+			Request:    req,
+		}, nil
+	}))
+	client.config.Resources, _ = parseResources("adlabels,pixels")
+	
+	entry, err := client.processAccount(AdAccount{ID: "act_1", AccountID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Registry order, not the order given to -resources
+	if len(paths) != 2 || !strings.HasSuffix(paths[0], "/act_1/adspixels") || !strings.HasSuffix(paths[1], "/act_1/adlabels") {
+		t.Fatalf("requested %v, want the pixels then the adlabels edge", paths)
+	}
+	if len(entry.Resources) != 2 {
+		t.Fatalf("manifest has %d resources, want 2: %+v", len(entry.Resources), entry.Resources)
+	}
+	for _, r := range entry.Resources {
+		if r.Status != statusOK || r.Count != 2 {
+			t.Errorf("%s: status %s, count %d, want OK with 2 records", r.Name, r.Status, r.Count)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// errRequestCap is returned instead of making a request once -max-requests
+// requests have been made.
+var errRequestCap = errors.New("request cap reached (-max-requests)")
+
+// requestBudget counts requests across all client copies and enforces
+// -max-requests.
+type requestBudget struct {
+	max    int64 // 0 = unlimited
+	used   int64
+	warned sync.Once
+}
+
+// take reserves one request, or returns errRequestCap when the budget is
+// spent.
+func (b *requestBudget) take() error {
+	if b == nil {
+		return nil
+	}
+	if atomic.AddInt64(&b.used, 1) <= b.max || b.max <= 0 {
+		return nil
+	}
+	b.warned.Do(func() {
+		log.Printf("WARNING: request cap of %d reached, no further requests will be made; data fetched so far is still written", b.max)
+	})
+	return errRequestCap
+}
+
+// count returns the number of requests made, or attempted past the cap.
+func (b *requestBudget) count() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.used)
+}
+
+// exhausted reports whether the cap has been hit.
+func (b *requestBudget) exhausted() bool {
+	return b != nil && b.max > 0 && atomic.LoadInt64(&b.used) >= b.max
+}
+
+// errByteCap is returned instead of making a request once -max-bytes
+// bytes have been downloaded.
+var errByteCap = errors.New("download cap reached (-max-bytes)")
+
+// byteBudget counts response body bytes, as received on the wire, across
+// all client copies and enforces -max-bytes. The response that crosses
+// the cap is still used; only further requests are refused.
+type byteBudget struct {
+	max    int64 // 0 = unlimited
+	used   int64
+	warned sync.Once
+}
+
+// add counts n downloaded bytes.
+func (b *byteBudget) add(n int64) {
+	if b != nil {
+		atomic.AddInt64(&b.used, n)
+	}
+}
+
+// check returns errByteCap when the cap has been hit.
+func (b *byteBudget) check() error {
+	if !b.exhausted() {
+		return nil
+	}
+	b.warned.Do(func() {
+		log.Printf("WARNING: download cap of %d bytes reached after %d bytes, no further requests will be made; data fetched so far is still written", b.max, b.count())
+	})
+	return errByteCap
+}
+
+// count returns the number of bytes downloaded.
+func (b *byteBudget) count() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.used)
+}
+
+// exhausted reports whether the cap has been hit.
+func (b *byteBudget) exhausted() bool {
+	return b != nil && b.max > 0 && atomic.LoadInt64(&b.used) >= b.max
+}
+
+// isRunLimit reports whether err is a run-wide limit (-max-requests,
+// -max-bytes or -max-run-time) rather than a failure of the request, so
+// the records collected so far are still worth writing.
+func isRunLimit(err error) bool {
+	return errors.Is(err, errRequestCap) || errors.Is(err, errByteCap) || errors.Is(err, errRunDeadline)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultResources returns the comma-separated resources fetched when
+// -resources is not given.
+func defaultResources() string {
+	var names []string
+	for _, r := range knownResources {
+		if r.Default {
+			names = append(names, r.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseResources validates a comma-separated -resources value against
+// knownResources.
+func parseResources(value string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	for _, name := range splitList(value) {
+		if !isKnownResource(name) {
+			return nil, fmt.Errorf("unknown resource %q", name)
+		}
+		selected[name] = true
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no resources selected")
+	}
+	return selected, nil
+}
+
+func isKnownResource(name string) bool {
+	for _, r := range knownResources {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printResources writes the -list-resources table.
+func printResources(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tEDGE\tDESCRIPTION")
+	for _, r := range knownResources {
+		description := r.Description
+		if r.Default {
+			description += " (default)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.listedPath(), description)
+	}
+	tw.Flush()
+}
+
+// splitList splits a comma-separated flag value, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// wants reports whether a resource was selected with -resources.
+func (c *APIClient) wants(resource string) bool {
+	return c.config.Resources[resource]
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func readManifest(path string) (Manifest, error) {
+	var manifest Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("reading manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("parsing manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// failedResources returns the resources of an account that need another
+// attempt. An account that failed as a whole is retried with every
+// selected resource.
+func (a *AccountManifest) failedResources(selected map[string]bool) map[string]bool {
+	if a.Error != "" {
+		return selected
+	}
+	failed := make(map[string]bool)
+	for _, r := range a.Resources {
+		if r.Status == statusFailed {
+			failed[r.Name] = true
+		}
+	}
+	return failed
+}
+
+// retryTargets lists the accounts of a previous manifest that had
+// failures, together with the resources to fetch again for each.
+func retryTargets(manifest Manifest, selected map[string]bool) ([]AdAccount, map[string]map[string]bool) {
+	var accounts []AdAccount
+	resources := make(map[string]map[string]bool)
+	for i := range manifest.Accounts {
+		entry := &manifest.Accounts[i]
+		failed := entry.failedResources(selected)
+		if len(failed) == 0 {
+			continue
+		}
+		accounts = append(accounts, AdAccount{ID: entry.ID, AccountID: entry.AccountID, Name: entry.Name})
+		resources[entry.ID] = failed
+	}
+	return accounts, resources
+}
+
+// mergeRetry folds the outcome of a retry into the account's previous
+// entry: retried resources replace their earlier result and everything
+// else is kept.
+func (a *AccountManifest) mergeRetry(retried AccountManifest) {
+	a.Error = retried.Error
+	if retried.Directory != "" {
+		a.Directory = retried.Directory
+	}
+	for _, r := range retried.Resources {
+		replaced := false
+		for i := range a.Resources {
+			if a.Resources[i].Name == r.Name {
+				a.Resources[i] = r
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			a.Resources = append(a.Resources, r)
+		}
+	}
+	if retried.Orphans != 0 {
+		a.Orphans = retried.Orphans
+	}
+	if retried.Spend != nil {
+		a.Spend = retried.Spend
+	}
+}
+
+// applyRetry merges retried account entries into the previous manifest.
+func applyRetry(manifest *Manifest, retried []AccountManifest) {
+	for _, r := range retried {
+		for i := range manifest.Accounts {
+			if manifest.Accounts[i].ID == r.ID {
+				manifest.Accounts[i].mergeRetry(r)
+				break
+			}
+		}
+	}
+}
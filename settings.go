@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+const (
+	accountSettingsFields = "id,account_id,min_daily_budget,business_country_code,capabilities,tax_id_status,attribution_spec"
+	// accountSettingsCoreFields are readable without elevated permissions
+	accountSettingsCoreFields = "id,account_id,min_daily_budget,business_country_code"
+)
+
+// fetchAccountSettings dumps the account's configured limits and settings
+// to account_settings.json. Some settings need elevated permissions, so a
+// request refused for lack of permissions is retried with the core
+// settings only; any other error is returned as it is.
+func (c *APIClient) fetchAccountSettings(accountID string, accountDir string) error {
+	c.logf("Requesting: %s (account settings)", accountID)
+	data, err := c.makeRequest(fmt.Sprintf("%s?fields=%s", accountID, accountSettingsFields))
+	if err != nil {
+		if !isPermissionError(err) {
+			return err
+		}
+		c.logf("Full account settings unavailable (%v), retrying with core fields only", err)
+		data, err = c.makeRequest(fmt.Sprintf("%s?fields=%s", accountID, accountSettingsCoreFields))
+		if err != nil {
+			return err
+		}
+	}
+	return c.dumpResponse("account_settings", data, accountDir)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// statusTransport answers every request with the same status and body.
+type statusTransport struct {
+	status   int
+	body     string
+	requests int
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestFetchAccountSettingsFallsBackOnlyOnPermissionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		requests int
+	}{
+		{"permission error", http.StatusForbidden, `{"error":{"message":"(#200) Requires business_management permission","code":200}}`, 2},
+		{"server error", http.StatusInternalServerError, `{"error":{"message":"An unknown error occurred","code":1}}`, 1},
+		{"invalid token", http.StatusBadRequest, `{"error":{"message":"Error validating access token","code":190}}`, 1},
+	}
+	for _, tt := range tests {
+		transport := &statusTransport{status: tt.status, body: tt.body}
+		client := newTestClient(transport)
+		client.config.NoRetry = true
+		err := client.fetchAccountSettings("act_1", "")
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: err = %v, want the API error", tt.name, err)
+		}
+		if transport.requests != tt.requests {
+			t.Errorf("%s: made %d requests, want %d", tt.name, transport.requests, tt.requests)
+		}
+	}
+}
+
+func TestFetchAdAccountFallsBackOnlyOnPermissionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		requests int
+	}{
+		{"permission error", http.StatusForbidden, `{"error":{"message":"(#200) Requires ads_management permission","code":200}}`, 2},
+		{"server error", http.StatusInternalServerError, `{"error":{"message":"An unknown error occurred","code":1}}`, 1},
+		{"rate limit", http.StatusBadRequest, `{"error":{"message":"User request limit reached","code":17}}`, 1},
+		{"invalid token", http.StatusBadRequest, `{"error":{"message":"Error validating access token","code":190}}`, 1},
+	}
+	for _, tt := range tests {
+		transport := &statusTransport{status: tt.status, body: tt.body}
+		client := newTestClient(transport)
+		client.config.NoRetry = true
+		err := client.fetchAdAccount("act_1", "")
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: err = %v, want the API error", tt.name, err)
+		}
+		if transport.requests != tt.requests {
+			t.Errorf("%s: made %d requests, want %d", tt.name, transport.requests, tt.requests)
+		}
+	}
+}
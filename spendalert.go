@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// spendChange compares the spend of the current insights dump with the
+// dump left by the previous run.
+type spendChange struct {
+	PreviousFile  string  `json:"previous_file"`
+	PreviousSpend float64 `json:"previous_spend"`
+	CurrentSpend  float64 `json:"current_spend"`
+	ChangePercent float64 `json:"change_percent"`
+	Alert         bool    `json:"alert"`
+}
+
+// dumpSpend sums the spend of every row in an insights dump.
+func dumpSpend(path string, material *keyMaterial) (float64, error) {
+	rows, err := readDumpRecords(path, material)
+	if err != nil {
+		return 0, err
+	}
+	totals, err := insightsTotals(rows)
+	if err != nil {
+		return 0, err
+	}
+	spend, _ := totals["spend"].(float64)
+	return spend, nil
+}
+
+// compareSpend compares the spend in the newest insights dump against the
+// previous one and logs a warning when it moved by more than
+// -spend-alert-threshold percent. Without a previous dump there is nothing
+// to compare against and the check is skipped.
+func (c *APIClient) compareSpend(entry *AccountManifest, accountDir, previous string) {
+	if previous == "" {
+		c.logf("No previous insights dump, skipping spend comparison")
+		return
+	}
+	current := latestDump(accountDir, "insights")
+	if current == "" || current == previous {
+		return
+	}
+	
+	previousSpend, err := dumpSpend(previous, c.dumpKey())
+	if err != nil {
+		c.logf("Skipping spend comparison: reading %s: %v", previous, err)
+		return
+	}
+	currentSpend, err := dumpSpend(current, c.dumpKey())
+	if err != nil {
+		c.logf("Skipping spend comparison: reading %s: %v", current, err)
+		return
+	}
+	
+	change := &spendChange{
+		PreviousFile:  previous,
+		PreviousSpend: previousSpend,
+		CurrentSpend:  currentSpend,
+	}
+	switch {
+	case previousSpend != 0:
+		change.ChangePercent = (currentSpend - previousSpend) / previousSpend * 100
+		change.Alert = math.Abs(change.ChangePercent) > c.config.SpendAlertThreshold
+	case currentSpend != 0:
+		// Spend appearing from nothing is always worth a look
+		change.ChangePercent = math.Inf(1)
+		change.Alert = true
+	}
+	
+	if change.Alert {
+		c.logf("WARNING: spend for %s changed from %.2f to %.2f (%s) since the previous run",
+			entry.ID, previousSpend, currentSpend, formatChange(change.ChangePercent))
+		if math.IsInf(change.ChangePercent, 0) {
+			// JSON has no infinity
+			change.ChangePercent = 0
+		}
+	} else {
+		c.logf("Spend changed %s since the previous run", formatChange(change.ChangePercent))
+	}
+	entry.Spend = change
+}
+
+func formatChange(percent float64) string {
+	if math.IsInf(percent, 0) {
+		return "new spend"
+	}
+	return fmt.Sprintf("%+.1f%%", percent)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// partOverhead approximates the bytes a part file spends outside its
+// records: braces, the "data" key and the part counters.
+const partOverhead = 64
+
+// filePart describes one part file in a split dump's index.
+type filePart struct {
+	File  string `json:"file"`
+	Count int    `json:"count"`
+}
+
+// groupBySize cuts records into consecutive groups whose estimated encoded
+// size stays under maxSize. A record that is larger on its own gets a group
+// to itself.
+func groupBySize(records []json.RawMessage, maxSize int64) [][]json.RawMessage {
+	var groups [][]json.RawMessage
+	var current []json.RawMessage
+	size := int64(partOverhead)
+	for _, record := range records {
+		// Records are re-indented one level deeper inside the data array
+		estimate := int64(len(record)+strings.Count(string(record), "\n")*4) + 6
+		if len(current) > 0 && size+estimate > maxSize {
+			groups = append(groups, current)
+			current, size = nil, partOverhead
+		}
+		current = append(current, record)
+		size += estimate
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// writeParts writes an envelope that exceeds -max-file-size as
+// <base>.part001.json, <base>.part002.json, ... each holding a slice of the
+// data array, plus <base>.json as an index listing the parts alongside the
+// envelope's other keys. It reports false when the envelope has no data
+// array to split, leaving the caller to write it whole.
+func (c *APIClient) writeParts(base string, formatted []byte) (bool, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(formatted, &envelope); err != nil {
+		return false, nil
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(envelope["data"], &records); err != nil || len(records) < 2 {
+		return false, nil
+	}
+	
+	groups := groupBySize(records, c.config.MaxFileSize)
+	var parts []filePart
+	for i, group := range groups {
+		filename := fmt.Sprintf("%s.part%03d.json", base, i+1)
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"data":  group,
+			"part":  i + 1,
+			"parts": len(groups),
+		}, "", "  ")
+		if err != nil {
+			return true, fmt.Errorf("encoding part: %w", err)
+		}
+		if int64(len(data)) > c.config.MaxFileSize {
+			c.logf("Warning: %s is %d bytes, over -max-file-size, because a single record is too large", filename, len(data))
+		}
+		if err := c.writeOutput(filename, data); err != nil {
+			return true, err
+		}
+		parts = append(parts, filePart{File: filepath.Base(c.writtenName(filename)), Count: len(group)})
+	}
+	
+	delete(envelope, "data")
+	partsJSON, _ := json.Marshal(parts)
+	envelope["parts"] = partsJSON
+	index, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return true, fmt.Errorf("encoding part index: %w", err)
+	}
+	if err := c.writeOutput(base+".json", index); err != nil {
+		return true, err
+	}
+	c.logf("Split into %d parts of at most %d bytes", len(parts), c.config.MaxFileSize)
+	return true, nil
+}
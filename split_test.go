@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitDumpRoundTrip(t *testing.T) {
+	var records []string
+	var want []string
+	for i := 1; i <= 20; i++ {
+		records = append(records, fmt.Sprintf(`{"id":"%d","name":"Campaign %d"}`, i, i))
+		want = append(want, fmt.Sprint(i))
+	}
+	formatted, _ := json.MarshalIndent(json.RawMessage(`{"data":[`+strings.Join(records, ",")+`],"summary":{"total_count":20}}`), "", "  ")
+	
+	for _, spec := range []string{"", writeKeyFile(t, 9)} {
+		client := newTestClient(nil)
+		client.config.MaxFileSize = 200
+		client.config.FileMode = 0600
+		if spec != "" {
+			encryptor, err := newFileEncryptor(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.encryptor = encryptor
+		}
+		base := filepath.Join(t.TempDir(), "campaigns_1700000000")
+		split, err := client.writeParts(base, formatted)
+		if err != nil || !split {
+			t.Fatalf("writeParts = %v, %v", split, err)
+		}
+		
+		index := client.writtenName(base + ".json")
+		if got := latestDump(filepath.Dir(base), "campaigns"); got != index {
+			t.Errorf("latestDump = %q, want the index %q", got, index)
+		}
+		got, err := readDumpRecords(index, client.dumpKey())
+		if err != nil {
+			t.Fatalf("encrypted %v: reading split dump: %v", spec != "", err)
+		}
+		if ids := recordIDsOf(t, got); !reflect.DeepEqual(ids, want) {
+			t.Errorf("encrypted %v: IDs = %v, want %v", spec != "", ids, want)
+		}
+		
+		// A part file read on its own holds just its slice
+		part, err := readDumpRecords(client.writtenName(base+".part001.json"), client.dumpKey())
+		if err != nil || len(part) == 0 || len(part) >= len(want) {
+			t.Errorf("encrypted %v: part 1 has %d records, %v", spec != "", len(part), err)
+		}
+	}
+}
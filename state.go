@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const insightsStateFile = "insights_state.json"
+
+// insightsState remembers how far insights have been dumped for an account
+// so that incremental runs only request the days after that.
+type insightsState struct {
+	LastUntil string    `json:"last_until"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func loadInsightsState(accountDir string) (insightsState, error) {
+	var state insightsState
+	data, err := os.ReadFile(filepath.Join(accountDir, insightsStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("reading insights state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("parsing insights state: %w", err)
+	}
+	return state, nil
+}
+
+func saveInsightsState(accountDir string, state insightsState, mode os.FileMode) error {
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding insights state: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(accountDir, insightsStateFile), data, mode); err != nil {
+		return fmt.Errorf("writing insights state: %w", err)
+	}
+	return nil
+}
+
+// nextDay returns the YYYY-MM-DD date following the given one.
+func nextDay(date string) (string, error) {
+	t, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q: %w", date, err)
+	}
+	return t.AddDate(0, 0, 1).Format(dateLayout), nil
+}
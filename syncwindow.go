@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// applySyncWindow limits the run to what changed within -sync-window of
+// now: list edges that support it are filtered on updated_time and
+// insights cover the days from the cutoff through today (UTC).
+func (cfg *Config) applySyncWindow(now time.Time) {
+	cutoff := now.Add(-cfg.SyncWindow)
+	cfg.UpdatedSince = cutoff
+	cfg.InsightsSince = cutoff.UTC().Format(dateLayout)
+	cfg.InsightsUntil = now.UTC().Format(dateLayout)
+}
+
+// updatedSinceFilter returns the filtering parameter selecting objects
+// updated after t.
+func updatedSinceFilter(t time.Time) string {
+	filter, _ := json.Marshal([]map[string]interface{}{{
+		"field":    "updated_time",
+		"operator": "GREATER_THAN",
+		"value":    t.Unix(),
+	}})
+	return "&filtering=" + url.QueryEscape(string(filter))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// recordMeta is the lineage information -tag-records adds to each record
+// under "_meta".
+type recordMeta struct {
+	RunID      string    `json:"run_id"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	APIVersion string    `json:"api_version"`
+	AccountID  string    `json:"account_id"`
+}
+
+// newRunID returns an identifier for this run, sortable by start time and
+// unique between runs started in the same second.
+func newRunID(started time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return started.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// tagRecords adds a _meta object to every record when -tag-records is set.
+// Records that aren't JSON objects are left untouched.
+func (c *APIClient) tagRecords(records []json.RawMessage) []json.RawMessage {
+	if !c.config.TagRecords {
+		return records
+	}
+	meta, _ := json.Marshal(recordMeta{
+		RunID:      c.config.RunID,
+		FetchedAt:  time.Now().UTC(),
+		APIVersion: c.config.APIVersion,
+		AccountID:  c.accountID,
+	})
+	for i, raw := range records {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &record); err != nil || record == nil {
+			continue
+		}
+		record["_meta"] = meta
+		if tagged, err := json.Marshal(record); err == nil {
+			records[i] = tagged
+		}
+	}
+	return records
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+const targetingSearchFields = "id,name,audience_size_lower_bound,audience_size_upper_bound,path,topic"
+
+// interest is an entry of a search?type=adinterest response.
+type interest struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	SizeLower int64    `json:"audience_size_lower_bound"`
+	SizeUpper int64    `json:"audience_size_upper_bound"`
+	Path      []string `json:"path"`
+	Topic     string   `json:"topic"`
+}
+
+// searchInterests looks up the interests matching query, for -targeting-search.
+func (c *APIClient) searchInterests(query string) ([]json.RawMessage, error) {
+	params := url.Values{}
+	params.Set("type", "adinterest")
+	params.Set("q", query)
+	params.Set("fields", targetingSearchFields)
+	params.Set("limit", "100")
+	return c.fetchPaginated("search?"+params.Encode(), "targeting_search")
+}
+
+// printInterests writes the interests as a table of IDs, names and
+// audience sizes.
+func printInterests(w io.Writer, records []json.RawMessage) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tAUDIENCE SIZE\tTOPIC")
+	for _, raw := range records {
+		var i interest
+		if err := json.Unmarshal(raw, &i); err != nil {
+			return fmt.Errorf("parsing interest: %w", err)
+		}
+		size := "-"
+		if i.SizeUpper > 0 {
+			size = fmt.Sprintf("%d-%d", i.SizeLower, i.SizeUpper)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", i.ID, i.Name, size, i.Topic)
+	}
+	return tw.Flush()
+}
+
+// targetingSearch runs -targeting-search: it prints the interests matching
+// query and, with -output, saves them to targeting_search.json.
+func (c *APIClient) targetingSearch(query string, w io.Writer) error {
+	records, err := c.searchInterests(query)
+	if err != nil {
+		return fmt.Errorf("searching interests: %w", err)
+	}
+	if records == nil {
+		records = []json.RawMessage{}
+	}
+	c.logf("Found %d interest(s) matching %q", len(records), query)
+	if err := printInterests(w, records); err != nil {
+		return err
+	}
+	
+	if c.config.OutputDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{"query": query, "data": records}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding interests: %w", err)
+	}
+	filename := filepath.Join(c.config.OutputDir, "targeting_search.json")
+	if err := c.writeOutput(filename, data); err != nil {
+		return err
+	}
+	c.logf("Saved to: %s", filename)
+	return nil
+}
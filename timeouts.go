@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// maxRequestTimeout caps the timeout grown by -timeout-multiplier.
+const maxRequestTimeout = 10 * time.Minute
+
+// defaultRequestTimeout applies to resources without their own -timeouts
+// entry when no default is given.
+const defaultRequestTimeout = 30 * time.Second
+
+// timeoutFallbacks lists the steps tracked under a name of their own that
+// isn't a -resources name, with the resource whose timeout they use when
+// they have no -timeouts entry.
+var timeoutFallbacks = map[string]string{
+	"insights_export": "insights",
+}
+
+// resourceTimeouts maps resource names, plus "default", to the time a
+// single request for that resource may take.
+type resourceTimeouts map[string]time.Duration
+
+// parseTimeouts parses a -timeouts value such as
+// "insights=120s,default=30s".
+func parseTimeouts(value string) (resourceTimeouts, error) {
+	timeouts := resourceTimeouts{"default": defaultRequestTimeout}
+	for _, item := range splitList(value) {
+		name, raw, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not resource=duration", item)
+		}
+		if _, ok := timeoutFallbacks[name]; name != "default" && !ok && !isKnownResource(name) {
+			return nil, fmt.Errorf("unknown resource %q", name)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration for %s: %q", name, raw)
+		}
+		timeouts[name] = d
+	}
+	return timeouts, nil
+}
+
+// forAttempt returns the timeout of a retried request: the resource's
+// timeout times multiplier^retryCount, capped at maxRequestTimeout.
+func (t resourceTimeouts) forAttempt(resource string, multiplier float64, retryCount int) time.Duration {
+	timeout := t.forResource(resource)
+	if multiplier <= 1 || retryCount == 0 {
+		return timeout
+	}
+	grown := float64(timeout) * math.Pow(multiplier, float64(retryCount))
+	if grown > float64(maxRequestTimeout) {
+		return maxRequestTimeout
+	}
+	return time.Duration(grown)
+}
+
+// forResource returns the request timeout for a resource, falling back to
+// the resource it belongs to in timeoutFallbacks and then to the default.
+func (t resourceTimeouts) forResource(resource string) time.Duration {
+	if d, ok := t[resource]; ok {
+		return d
+	}
+	if d, ok := t[timeoutFallbacks[resource]]; ok {
+		return d
+	}
+	if d, ok := t["default"]; ok {
+		return d
+	}
+	return defaultRequestTimeout
+}
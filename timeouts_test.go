@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutsForInsightsExport(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"insights_export=10m,insights=2m", 10 * time.Minute},
+		{"insights=2m,default=45s", 2 * time.Minute},
+		{"default=45s", 45 * time.Second},
+		{"", defaultRequestTimeout},
+	}
+	for _, tt := range tests {
+		timeouts, err := parseTimeouts(tt.value)
+		if err != nil {
+			t.Fatalf("parseTimeouts(%q): %v", tt.value, err)
+		}
+		if got := timeouts.forResource("insights_export"); got != tt.want {
+			t.Errorf("-timeouts %q: insights_export gets %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	if _, err := parseTimeouts("insights_exports=1m"); err == nil {
+		t.Error("parseTimeouts accepted an unknown resource")
+	}
+}
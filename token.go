@@ -0,0 +1,20 @@
+package main
+
+import "context"
+
+// TokenProvider supplies the access token for each request. It is asked
+// on every request, so implementations can rotate or refresh the token
+// during a run.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticTokenProvider always returns the same token, such as the one given
+// with -token.
+type StaticTokenProvider struct {
+	AccessToken string
+}
+
+func (p StaticTokenProvider) Token(ctx context.Context) (string, error) {
+	return p.AccessToken, nil
+}
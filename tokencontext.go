@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TokenContext describes who the access token acts as and which
+// businesses it operates in, which explains the set of ad accounts
+// discovery returns.
+type TokenContext struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Businesses  []json.RawMessage `json:"businesses"`
+	AssetGroups []json.RawMessage `json:"assigned_business_asset_groups,omitempty"`
+	SystemUser  bool              `json:"system_user"`
+}
+
+// fetchTokenContext calls me and the business edges of me. Business asset
+// groups are only assigned to system users, so a successful lookup there
+// is what marks the token as a system-user token.
+func (c *APIClient) fetchTokenContext() (*TokenContext, error) {
+	c.logf("Requesting: me (token context)")
+	data, err := c.makeRequest("me?fields=id,name")
+	if err != nil {
+		return nil, err
+	}
+	var ctx TokenContext
+	if err := json.Unmarshal(data, &ctx); err != nil {
+		return nil, fmt.Errorf("parsing me response: %w", err)
+	}
+	
+	businesses, err := c.fetchPaginated("me/businesses?fields=id,name,verification_status&limit=100", "businesses")
+	if err != nil {
+		c.logf("Could not list businesses for the token: %v", err)
+	}
+	ctx.Businesses = businesses
+	
+	groups, err := c.fetchPaginated("me/assigned_business_asset_groups?fields=id,name&limit=100", "asset groups")
+	if err == nil {
+		ctx.AssetGroups = groups
+		ctx.SystemUser = true
+	} else if c.config.Debug {
+		c.logf("[DEBUG] No business asset groups (not a system-user token?): %v", err)
+	}
+	return &ctx, nil
+}
+
+// warmup makes a single me request so the TLS connection is established
+// and the token validated before concurrent account processing starts.
+// The token context lookup does the same when -token-context is set.
+func (c *APIClient) warmup() {
+	started := time.Now()
+	if _, err := c.makeRequest("me?fields=id"); err != nil {
+		c.logf("Warmup request failed: %v", err)
+		return
+	}
+	c.logf("Warmup request took %v", time.Since(started).Round(time.Millisecond))
+}
+
+// logTokenContext reports the token's identity and business scope, and
+// dumps it to token_context.json.
+func (c *APIClient) logTokenContext() {
+	ctx, err := c.fetchTokenContext()
+	if err != nil {
+		c.logf("Error fetching token context: %v", err)
+		return
+	}
+	
+	kind := "user"
+	if ctx.SystemUser {
+		kind = "system user"
+	}
+	c.logf("Token acts as %s %q (%s)", kind, ctx.Name, ctx.ID)
+	for _, raw := range ctx.Businesses {
+		var business struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		json.Unmarshal(raw, &business)
+		c.logf("  Business: %s (%s)", business.Name, business.ID)
+	}
+	if len(ctx.Businesses) == 0 {
+		c.logf("  No businesses visible: only personally assigned ad accounts will be discovered")
+	}
+	if ctx.SystemUser {
+		c.logf("  Assigned business asset groups: %d", len(ctx.AssetGroups))
+	}
+	
+	contextJSON, _ := json.Marshal(ctx)
+	if err := c.dumpResponse("token_context", contextJSON, c.config.OutputDir); err != nil {
+		c.logf("Error writing token context: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// requestTrace records connection phase timings of a single request for
+// -trace.
+type requestTrace struct {
+	start                                 time.Time
+	dnsStart, connectStart, tlsStart      time.Time
+	dns, connect, tlsHandshake, firstByte time.Duration
+	reused                                bool
+	// connectMu guards the connect timings: with dual-stack dialing
+	// several connection attempts can report concurrently, and a losing
+	// one may still finish after the response arrived
+	connectMu sync.Mutex
+}
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{start: time.Now()}
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.reused = info.Reused
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.dns = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.connectMu.Lock()
+			defer t.connectMu.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		// Only the first connection that succeeds is recorded, the one
+		// the request goes out on
+		ConnectDone: func(_, _ string, err error) {
+			t.connectMu.Lock()
+			defer t.connectMu.Unlock()
+			if err == nil && t.connect == 0 {
+				t.connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.tlsHandshake = time.Since(t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.firstByte = time.Since(t.start)
+		},
+	}
+}
+
+// logTrace prints the timings of a request through the account's logger.
+// DNS, connect and TLS are zero when a kept-alive connection was reused.
+func (c *APIClient) logTrace(t *requestTrace, maskedURL string) {
+	t.connectMu.Lock()
+	connect := t.connect
+	t.connectMu.Unlock()
+	c.logf("[DEBUG] Trace %s: dns=%v connect=%v tls=%v ttfb=%v total=%v reused=%t",
+		maskedURL, t.dns.Round(time.Millisecond), connect.Round(time.Millisecond),
+		t.tlsHandshake.Round(time.Millisecond), t.firstByte.Round(time.Millisecond),
+		time.Since(t.start).Round(time.Millisecond), t.reused)
+}
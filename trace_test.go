@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestTraceRecordsFirstSuccessfulConnect(t *testing.T) {
+	trace := newRequestTrace()
+	hooks := trace.clientTrace()
+	
+	// Dual-stack dialing: both families start together, IPv6 fails, IPv4
+	// connects
+	var wg sync.WaitGroup
+	for _, network := range []string{"tcp6", "tcp4"} {
+		wg.Add(1)
+		go func(network string) {
+			defer wg.Done()
+			hooks.ConnectStart(network, "graph.facebook.com:443")
+			if network == "tcp6" {
+				hooks.ConnectDone(network, "[2a03::1]:443", errors.New("network unreachable"))
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+			hooks.ConnectDone(network, "157.240.0.1:443", nil)
+		}(network)
+	}
+	wg.Wait()
+	recorded := trace.connect
+	if recorded < 5*time.Millisecond {
+		t.Errorf("connect = %v, want the successful attempt's time", recorded)
+	}
+	
+	// A late attempt doesn't overwrite it
+	hooks.ConnectStart("tcp4", "157.240.0.2:443")
+	hooks.ConnectDone("tcp4", "157.240.0.2:443", nil)
+	if trace.connect != recorded {
+		t.Errorf("connect changed from %v to %v after a later attempt", recorded, trace.connect)
+	}
+}
+
+func TestLogTraceUsesAccountLogger(t *testing.T) {
+	var buf bytes.Buffer
+	client := &APIClient{logger: log.New(&buf, "[act_1] ", log.Lmsgprefix)}
+	client.logTrace(newRequestTrace(), "https://graph.facebook.com/v19.0/act_1/ads?access_token=***")
+	if line := buf.String(); !strings.HasPrefix(line, "[act_1] [DEBUG] Trace https://graph.facebook.com/") {
+		t.Errorf("trace logged %q, want it through the account logger", line)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+)
+
+const accountTreeFile = "account_tree.json"
+
+// accountTree is the nested campaigns → ad sets → ads view written with
+// -tree. Objects whose parent wasn't fetched, for example because of a
+// status filter, are kept under _orphans with their own children.
+type accountTree struct {
+	Campaigns []map[string]interface{} `json:"campaigns"`
+	Orphans   struct {
+		AdSets []map[string]interface{} `json:"adsets"`
+		Ads    []map[string]interface{} `json:"ads"`
+	} `json:"_orphans"`
+}
+
+func decodeRecords(raw []json.RawMessage) []map[string]interface{} {
+	records := make([]map[string]interface{}, 0, len(raw))
+	for _, r := range raw {
+		var record map[string]interface{}
+		if err := json.Unmarshal(r, &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// nestChildren attaches every child to its parent under key and returns
+// the children whose parent is unknown. Each parent gets key set, so
+// parents without children carry an empty list.
+func nestChildren(parents, children []map[string]interface{}, parentKey, key string) []map[string]interface{} {
+	byID := make(map[string]map[string]interface{}, len(parents))
+	for _, parent := range parents {
+		parent[key] = []map[string]interface{}{}
+		if id, ok := parent["id"].(string); ok {
+			byID[id] = parent
+		}
+	}
+	orphans := []map[string]interface{}{}
+	for _, child := range children {
+		parentID, _ := child[parentKey].(string)
+		parent, ok := byID[parentID]
+		if !ok {
+			orphans = append(orphans, child)
+			continue
+		}
+		parent[key] = append(parent[key].([]map[string]interface{}), child)
+	}
+	return orphans
+}
+
+// buildAccountTree nests ad sets into their campaigns by campaign_id and
+// ads into their ad sets by adset_id.
+func buildAccountTree(campaigns, adsets, ads []json.RawMessage) accountTree {
+	var tree accountTree
+	tree.Campaigns = decodeRecords(campaigns)
+	adsetRecords := decodeRecords(adsets)
+	tree.Orphans.Ads = nestChildren(adsetRecords, decodeRecords(ads), "adset_id", "ads")
+	tree.Orphans.AdSets = nestChildren(tree.Campaigns, adsetRecords, "campaign_id", "adsets")
+	return tree
+}
+
+// writeAccountTree writes account_tree.json for -tree once campaigns, ad
+// sets and ads were all fetched.
+func (c *APIClient) writeAccountTree(entry *AccountManifest, campaigns, adsets, ads []json.RawMessage, accountDir string) {
+	for _, resource := range []string{"campaigns", "adsets", "ads"} {
+		if !entry.succeeded(resource) {
+			c.logf("Skipping account tree: %s were not fetched", resource)
+			return
+		}
+	}
+	
+	tree := buildAccountTree(campaigns, adsets, ads)
+	treeJSON, _ := json.MarshalIndent(tree, "", "  ")
+	filename := filepath.Join(accountDir, accountTreeFile)
+	if err := c.writeOutput(filename, treeJSON); err != nil {
+		c.logf("Error writing account tree: %v", err)
+		return
+	}
+	c.logf("Saved account tree (%d campaigns, %d orphan ad sets, %d orphan ads) to: %s",
+		len(tree.Campaigns), len(tree.Orphans.AdSets), len(tree.Orphans.Ads), filename)
+}
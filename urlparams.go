@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// creativeURLFields replaces a plain creative field when -strip-url-params
+// is set: on its own, creative only returns the creative's id, and none of
+// the URLs the parameters are to be stripped from.
+const creativeURLFields = "creative{id,object_story_spec,image_url,link_url,url_tags}"
+
+// expandCreativeFields requests the URL fields of creatives in place of a
+// plain creative field. An explicit creative{...} expansion is kept.
+func expandCreativeFields(fields string) string {
+	items := strings.Split(fields, ",")
+	for i, item := range items {
+		if strings.TrimSpace(item) == "creative" {
+			items[i] = creativeURLFields
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// stripURLParams removes the named query parameters from every http(s) URL
+// string in v, walking nested objects and arrays, and from url_tags, the
+// query string creatives append to their links. Creatives carry URLs in
+// many places (link, image_url, object_story_spec), so every string is
+// checked rather than a fixed list of fields.
+func stripURLParams(v interface{}, params map[string]bool) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if tags, ok := child.(string); ok && k == "url_tags" {
+				value[k] = stripQueryParams(tags, params)
+				continue
+			}
+			value[k] = stripURLParams(child, params)
+		}
+		return value
+	case []interface{}:
+		for i, child := range value {
+			value[i] = stripURLParams(child, params)
+		}
+		return value
+	case string:
+		return stripURLStringParams(value, params)
+	}
+	return v
+}
+
+func stripURLStringParams(s string, params map[string]bool) string {
+	if !strings.HasPrefix(s, "https://") && !strings.HasPrefix(s, "http://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.RawQuery == "" {
+		return s
+	}
+	stripped := stripQueryParams(u.RawQuery, params)
+	if stripped == u.RawQuery {
+		return s
+	}
+	u.RawQuery = stripped
+	return u.String()
+}
+
+// stripQueryParams removes the named parameters from a query string. An
+// unchanged query is returned exactly as given.
+func stripQueryParams(rawQuery string, params map[string]bool) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	changed := false
+	for name := range query {
+		if params[name] {
+			query.Del(name)
+			changed = true
+		}
+	}
+	if !changed {
+		return rawQuery
+	}
+	return query.Encode()
+}
+
+// stripRecordURLParams applies -strip-url-params to each record. Records
+// that aren't valid JSON are left as they are.
+func stripRecordURLParams(records []json.RawMessage, params []string) []json.RawMessage {
+	names := make(map[string]bool, len(params))
+	for _, p := range params {
+		names[p] = true
+	}
+	for i, raw := range records {
+		var record interface{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		if stripped, err := json.Marshal(stripURLParams(record, names)); err == nil {
+			records[i] = stripped
+		}
+	}
+	return records
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripURLParamsNestedCreative(t *testing.T) {
+	records := []json.RawMessage{json.RawMessage(`{
+		"id": "1",
+		"creative": {
+			"id": "10",
+			"image_url": "https://cdn.example.com/a.jpg?utm_campaign=spring&w=600",
+			"link_url": "https://shop.example.com/?secret=abc",
+			"url_tags": "utm_campaign=spring&utm_source=facebook&secret=abc",
+			"object_story_spec": {
+				"link_data": {
+					"link": "https://shop.example.com/sale?utm_campaign=spring&ref=ad",
+					"child_attachments": [{"link": "https://shop.example.com/item?secret=abc&id=7"}],
+					"message": "Spring sale, see https://shop.example.com/?secret=abc"
+				}
+			}
+		}
+	}`)}
+	stripped := stripRecordURLParams(records, []string{"utm_campaign", "secret"})
+	
+	var got map[string]interface{}
+	if err := json.Unmarshal(stripped[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"id": "1",
+		"creative": {
+			"id": "10",
+			"image_url": "https://cdn.example.com/a.jpg?w=600",
+			"link_url": "https://shop.example.com/",
+			"url_tags": "utm_source=facebook",
+			"object_story_spec": {
+				"link_data": {
+					"link": "https://shop.example.com/sale?ref=ad",
+					"child_attachments": [{"link": "https://shop.example.com/item?id=7"}],
+					"message": "Spring sale, see https://shop.example.com/?secret=abc"
+				}
+			}
+		}
+	}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stripped record =\n%s\nwant the parameters removed from every URL and url_tags", stripped[0])
+	}
+}
+
+func TestExpandCreativeFields(t *testing.T) {
+	tests := []struct{ fields, want string }{
+		{defaultAdFields, "id,name,status,effective_status,adset_id," + creativeURLFields + ",created_time"},
+		{"id,creative{id,link_url}", "id,creative{id,link_url}"},
+		{"id,name", "id,name"},
+	}
+	for _, tt := range tests {
+		if got := expandCreativeFields(tt.fields); got != tt.want {
+			t.Errorf("expandCreativeFields(%q) = %q, want %q", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestAdsRequestCreativeURLsWhenStripping(t *testing.T) {
+	for _, strip := range []bool{false, true} {
+		var fields string
+		client := newTestClient(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			fields = req.URL.Query().Get("fields")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"data":[]}`)),
+				Request:    req,
+			}, nil
+		}))
+		if strip {
+			client.config.StripURLParams = []string{"utm_campaign"}
+		}
+		var ads Resource
+		for _, r := range knownResources {
+			if r.Name == "ads" {
+				ads = r
+			}
+		}
+		if _, err := client.fetchResource("act_1", "", ads); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(fields, creativeURLFields); got != strip {
+			t.Errorf("stripping %v: requested fields %q", strip, fields)
+		}
+	}
+}
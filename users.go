@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Business is a business the token can see through me/businesses.
+type Business struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (c *APIClient) fetchBusinesses() ([]Business, error) {
+	allData, err := c.fetchPaginated("me/businesses?fields=id,name&limit=100", "businesses")
+	if err != nil {
+		return nil, err
+	}
+	var businesses []Business
+	for _, raw := range allData {
+		var business Business
+		if err := json.Unmarshal(raw, &business); err != nil {
+			return nil, fmt.Errorf("parsing business: %w", err)
+		}
+		businesses = append(businesses, business)
+	}
+	return businesses, nil
+}
+
+func (c *APIClient) fetchBusinessUsers(businessID string) ([]json.RawMessage, error) {
+	c.logf("Requesting: business users for business %s", businessID)
+	return c.fetchPaginated(businessID+"/business_users?fields=id,name,email,role&limit=100", "business users")
+}
+
+func (c *APIClient) fetchSystemUsers(businessID string) ([]json.RawMessage, error) {
+	c.logf("Requesting: system users for business %s", businessID)
+	return c.fetchPaginated(businessID+"/system_users?fields=id,name,role&limit=100", "system users")
+}
+
+// dumpBusinessUsers writes business_users.json and system_users.json for
+// every business the token can see. Listing users needs admin access to
+// the business; businesses where the token lacks it are logged and skipped.
+func (c *APIClient) dumpBusinessUsers() error {
+	businesses, err := c.fetchBusinesses()
+	if err != nil {
+		return fmt.Errorf("fetching businesses: %w", err)
+	}
+	c.logf("Found %d business(es) for user listing", len(businesses))
+	
+	edges := []struct {
+		name  string
+		fetch func(string) ([]json.RawMessage, error)
+	}{
+		{"business_users", c.fetchBusinessUsers},
+		{"system_users", c.fetchSystemUsers},
+	}
+	for _, business := range businesses {
+		var businessDir string
+		if c.config.OutputDir != "" {
+			dirName := business.ID
+			if safeName := sanitizeName(business.Name, c.config.NameSanitize); safeName != "" {
+				dirName = fmt.Sprintf("%s_%s", business.ID, safeName)
+			}
+			businessDir = filepath.Join(c.config.OutputDir, "businesses", dirName)
+			if err := os.MkdirAll(businessDir, c.config.DirMode); err != nil {
+				return fmt.Errorf("creating business directory: %w", err)
+			}
+		}
+		
+		for _, edge := range edges {
+			users, err := edge.fetch(business.ID)
+			if err != nil {
+				if isPermissionError(err) {
+					c.logf("Skipping %s of business %s: the token needs admin access (%v)", edge.name, business.Name, err)
+				} else {
+					c.logf("Error fetching %s of business %s: %v", edge.name, business.Name, err)
+				}
+				continue
+			}
+			
+			aggregatedResponse := map[string]interface{}{
+				"data": users,
+				"summary": map[string]interface{}{
+					"total_count": len(users),
+				},
+			}
+			responseJSON, _ := json.Marshal(aggregatedResponse)
+			if err := c.dumpResponse(edge.name, responseJSON, businessDir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build metadata, injected at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// BuildInfo identifies the build that produced a dump.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func buildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("facebook-ads-api-dumper %s (commit %s, built %s, %s)", b.Version, b.Commit, b.BuildDate, b.GoVersion)
+}
+
+// userAgent is sent with every Graph API request.
+func userAgent() string {
+	return fmt.Sprintf("facebook-ads-api-dumper/%s (+https://github.com/sstreichan/facebook-ads-api-dumper)", version)
+}